@@ -0,0 +1,259 @@
+package graphqlc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultListArguments are the arguments taken to set the size of a list
+// field unless CostOptions.ListArguments is set.
+var DefaultListArguments = []string{"first", "last", "limit"}
+
+// CostOptions tunes how Analyze estimates the cost of an operation.
+type CostOptions struct {
+	// ListArguments are the arguments, literal or variable, that set how
+	// many items a list field returns. Defaults to DefaultListArguments.
+	ListArguments []string
+	// ListSizes is the expected size of list fields, by field name, when no
+	// list argument is given.
+	ListSizes map[string]int
+}
+
+// Complexity describes the size of an operation.
+type Complexity struct {
+	// Depth is the deepest nesting of fields, top level fields being at
+	// depth 1.
+	Depth int
+	// Fields is the number of fields selected, with fragments expanded.
+	Fields int
+	// Cost estimates the number of fields resolved by the server: each field
+	// costs 1, times the sizes of the lists it is nested in. It stops
+	// growing at MaxCost.
+	Cost int
+}
+
+// MaxCost is the highest cost Analyze reports. Costs above it, which would
+// overflow, are reported as MaxCost.
+const MaxCost = math.MaxInt32
+
+// Analyze parses the first operation of query, expanding fragments, and
+// measures its complexity. Variables are used to resolve list arguments
+// passed as variables.
+func Analyze(query string, vars map[string]interface{}, opts CostOptions) (*Complexity, error) {
+	doc, err := parseDocumentAST(query)
+	if err != nil {
+		return nil, err
+	}
+	op := doc.operation()
+	if op == nil {
+		return nil, errors.New("graphql: no operation in document")
+	}
+	if opts.ListArguments == nil {
+		opts.ListArguments = DefaultListArguments
+	}
+	a := &analyzer{fragments: make(map[string][]astSelection), vars: vars, opts: opts, expanding: make(map[string]bool)}
+	for _, def := range doc.definitions {
+		if def.kind != "fragment" {
+			continue
+		}
+		if _, ok := a.fragments[def.name]; ok {
+			return nil, errors.Errorf("graphql: fragment %q is defined twice", def.name)
+		}
+		a.fragments[def.name] = def.selections
+	}
+	cx := &Complexity{}
+	if err := a.selections(op.selections, 1, 1, cx); err != nil {
+		return nil, err
+	}
+	return cx, nil
+}
+
+// Analyze measures the complexity of the request's operation, see Analyze.
+func (req *Request) Analyze(opts CostOptions) (*Complexity, error) {
+	return Analyze(req.q, req.vars, opts)
+}
+
+// Limits caps the complexity of operations sent by a Client, see
+// WithLimits. Zero fields are not enforced.
+type Limits struct {
+	MaxDepth  int
+	MaxFields int
+	MaxCost   int
+	Cost      CostOptions
+}
+
+// LimitError is returned for operations over the limits set with
+// WithLimits. They are not sent.
+type LimitError struct {
+	Complexity Complexity
+	// Limit is the exceeded limit: "depth", "fields" or "cost".
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	var got int
+	switch e.Limit {
+	case "depth":
+		got = e.Complexity.Depth
+	case "fields":
+		got = e.Complexity.Fields
+	case "cost":
+		got = e.Complexity.Cost
+	}
+	return fmt.Sprintf("graphql: operation %s %d exceeds the limit of %d", e.Limit, got, e.Max)
+}
+
+// WithLimits refuses to send operations whose depth, field count or
+// estimated cost exceeds l, returning a *LimitError instead. Operations that
+// can't be parsed are refused too.
+func WithLimits(l Limits) ClientOption {
+	return func(c *Client) {
+		c.queryLimits = &l
+	}
+}
+
+// checkLimits returns an error if req exceeds the client's limits.
+func (c *Client) checkLimits(req *Request) error {
+	if c.queryLimits == nil {
+		return nil
+	}
+	cx, err := req.Analyze(c.queryLimits.Cost)
+	if err != nil {
+		return err
+	}
+	for _, l := range []struct {
+		name     string
+		got, max int
+	}{
+		{"depth", cx.Depth, c.queryLimits.MaxDepth},
+		{"fields", cx.Fields, c.queryLimits.MaxFields},
+		{"cost", cx.Cost, c.queryLimits.MaxCost},
+	} {
+		if l.max > 0 && l.got > l.max {
+			return &LimitError{Complexity: *cx, Limit: l.name, Max: l.max}
+		}
+	}
+	return nil
+}
+
+type analyzer struct {
+	fragments map[string][]astSelection
+	vars      map[string]interface{}
+	opts      CostOptions
+	expanding map[string]bool
+}
+
+// selections adds the complexity of sels, found at depth and repeated mult
+// times, to cx.
+func (a *analyzer) selections(sels []astSelection, depth, mult int, cx *Complexity) error {
+	for _, sel := range sels {
+		switch {
+		case sel.field != nil:
+			f := sel.field
+			cx.Fields++
+			cx.Cost = addCost(cx.Cost, mult)
+			if depth > cx.Depth {
+				cx.Depth = depth
+			}
+			if len(f.selections) > 0 {
+				if err := a.selections(f.selections, depth+1, mulCost(mult, a.listSize(f)), cx); err != nil {
+					return err
+				}
+			}
+		case sel.spread != "":
+			frag, ok := a.fragments[sel.spread]
+			if !ok {
+				return errors.Errorf("graphql: undefined fragment %q", sel.spread)
+			}
+			if a.expanding[sel.spread] {
+				return errors.Errorf("graphql: fragment %q spreads itself", sel.spread)
+			}
+			a.expanding[sel.spread] = true
+			err := a.selections(frag, depth, mult, cx)
+			a.expanding[sel.spread] = false
+			if err != nil {
+				return err
+			}
+		default:
+			if err := a.selections(sel.inline, depth, mult, cx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listSize returns how many times the selections of f are repeated.
+func (a *analyzer) listSize(f *astField) int {
+	for _, name := range a.opts.ListArguments {
+		v, ok := f.args[name]
+		if !ok {
+			continue
+		}
+		if ref, ok := v.(astVariable); ok {
+			v = a.vars[string(ref)]
+		}
+		if n, ok := numberValue(v); ok {
+			return clampSize(n)
+		}
+	}
+	if n, ok := a.opts.ListSizes[f.name]; ok {
+		return clampSize(float64(n))
+	}
+	return 1
+}
+
+// numberValue returns v as a float64 if it is a number of any kind, a
+// json.Number, or a pointer to one.
+func numberValue(v interface{}) (float64, bool) {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// mulCost returns a*b, or MaxCost if it is more. a and b are at least 1.
+func mulCost(a, b int) int {
+	if a > MaxCost/b {
+		return MaxCost
+	}
+	return a * b
+}
+
+// addCost returns a+b, or MaxCost if it is more. a and b are at most
+// MaxCost.
+func addCost(a, b int) int {
+	if a > MaxCost-b {
+		return MaxCost
+	}
+	return a + b
+}
+
+// clampSize returns n as a list size between 1 and MaxCost.
+func clampSize(n float64) int {
+	switch {
+	case n >= MaxCost:
+		return MaxCost
+	case n < 1:
+		return 1
+	}
+	return int(n)
+}
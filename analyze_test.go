@@ -0,0 +1,150 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestAnalyze(t *testing.T) {
+	is := is.New(t)
+	q := `
+		# users and their repositories
+		query Users($n: Int!, $filter: UserFilter = {active: true}) @cached(ttl: 60) {
+			viewer { login }
+			users(first: $n, where: {name: {_like: "a%"}}, tags: ["x", "y"]) {
+				...userFields
+				repositories(last: 10) @include(if: true) {
+					nodes { name stars }
+				}
+			}
+		}
+
+		fragment userFields on User {
+			id
+			name: login
+			... on Admin { permissions }
+		}
+	`
+	cx, err := Analyze(q, map[string]interface{}{"n": 20}, CostOptions{})
+	is.NoErr(err)
+	is.Equal(cx.Depth, 4)   // users.repositories.nodes.name
+	is.Equal(cx.Fields, 10) // viewer login users id name permissions repositories nodes name stars
+	// viewer, login, users: 3
+	// id, name, permissions, repositories: 4 * 20
+	// nodes: 20 * 10; name, stars: 2 * 20 * 10
+	is.Equal(cx.Cost, 3+4*20+200+2*200)
+
+	cx, err = Analyze(`{ items { tags { name } } }`, nil, CostOptions{ListSizes: map[string]int{"items": 50, "tags": 5}})
+	is.NoErr(err)
+	is.Equal(*cx, Complexity{Depth: 3, Fields: 3, Cost: 1 + 50 + 250})
+
+	req := NewRequest(`query ($limit: Int) { logs(limit: $limit) { line } }`)
+	req.Var("limit", 1000)
+	cx, err = req.Analyze(CostOptions{})
+	is.NoErr(err)
+	is.Equal(cx.Cost, 1001)
+}
+
+func TestAnalyzeOverflow(t *testing.T) {
+	is := is.New(t)
+	q := `{ a(first: 100000) { b(first: 100000) { c(first: 100000) { d(first: 100000) { e(first: 100000) { f } } } } } }`
+	cx, err := Analyze(q, nil, CostOptions{})
+	is.NoErr(err)
+	is.Equal(cx.Cost, MaxCost)
+
+	req := NewRequest(`query ($n: Int) { a(first: $n) { b(limit: 1e30) { c } } }`)
+	req.Var("n", int64(1)<<62)
+	cx, err = req.Analyze(CostOptions{})
+	is.NoErr(err)
+	is.Equal(cx.Cost, MaxCost)
+
+	client := NewClient("http://localhost/", WithLimits(Limits{MaxCost: 1000}))
+	err = client.RunCtxRet(context.Background(), NewRequest(q), nil)
+	limitErr, ok := err.(*LimitError)
+	is.True(ok)
+	is.Equal(limitErr.Limit, "cost")
+}
+
+func TestAnalyzeVariableKinds(t *testing.T) {
+	is := is.New(t)
+	n := uint16(5000)
+	for _, v := range []interface{}{
+		int32(5000), int16(5000), uint(5000), uint64(5000), float32(5000), json.Number("5000"), &n,
+	} {
+		req := NewRequest(`query ($n: Int) { items(first: $n) { id } }`)
+		req.Var("n", v)
+		cx, err := req.Analyze(CostOptions{})
+		is.NoErr(err)
+		is.Equal(cx.Cost, 5001) // 1 for items, 5000 for its ids
+	}
+
+	client := NewClient("http://localhost/", WithLimits(Limits{MaxCost: 1000}))
+	req := NewRequest(`query ($n: Int) { items(first: $n) { id } }`)
+	req.Var("n", int32(5000))
+	_, ok := client.RunCtxRet(context.Background(), req, nil).(*LimitError)
+	is.True(ok)
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		query, err string
+	}{
+		{`{ user { ...missing } }`, `graphql: undefined fragment "missing"`},
+		{`{ ...a } fragment a on Q { ...a }`, `graphql: fragment "a" spreads itself`},
+		{`{ user { id }`, `graphql: syntax error at offset 13: expected "}", got the end of the document`},
+		{`{ user(id: ) { id } }`, `graphql: syntax error at offset 11: unexpected ")"`},
+		{`fragment a on Q { id }`, `graphql: no operation in document`},
+		{`query`, `graphql: syntax error at offset 5: expected "{", got the end of the document`},
+		{`mutation`, `graphql: syntax error at offset 8: expected "{", got the end of the document`},
+		{`subscription S`, `graphql: syntax error at offset 14: expected "{", got the end of the document`},
+		{`query Q(`, `graphql: syntax error at offset 8: unbalanced "("`},
+		{`fragment`, `graphql: syntax error at offset 8: expected a name, got the end of the document`},
+	} {
+		t.Run(tt.query, func(t *testing.T) {
+			is := is.New(t)
+			_, err := Analyze(tt.query, nil, CostOptions{})
+			is.True(err != nil)
+			is.Equal(err.Error(), tt.err)
+		})
+	}
+}
+
+func TestWithLimits(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithLimits(Limits{MaxDepth: 3, MaxCost: 100}))
+
+	ctx := context.Background()
+	is.NoErr(client.RunCtxRet(ctx, NewRequest(`{ users(first: 10) { posts(first: 5) { id } } }`), nil))
+	is.Equal(calls, 1)
+
+	err := client.RunCtxRet(ctx, NewRequest(`{ a { b { c { d } } } }`), nil)
+	limitErr, ok := err.(*LimitError)
+	is.True(ok)
+	is.Equal(limitErr.Limit, "depth")
+	is.Equal(err.Error(), "graphql: operation depth 4 exceeds the limit of 3")
+
+	err = client.RunCtxRet(ctx, NewRequest(`{ users(first: 10) { posts(first: 20) { id } } }`), nil)
+	is.Equal(err.Error(), "graphql: operation cost 211 exceeds the limit of 100")
+
+	// a truncated query is refused, not sent
+	err = client.RunCtxRet(ctx, NewRequest(`query`), nil)
+	is.True(err != nil)
+
+	events := make(chan SubscriptionEvent, 1)
+	client.Subscribe(ctx, NewRequest(`subscription { a { b { c { d } } } }`), events)
+	ev := <-events
+	_, ok = ev.Err.(*LimitError)
+	is.True(ok)
+	is.Equal(calls, 1)
+}
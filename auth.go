@@ -0,0 +1,212 @@
+package graphqlc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Token is a credential sent in the Authorization header.
+type Token struct {
+	AccessToken string
+	// TokenType is the authorization scheme, "Bearer" if empty.
+	TokenType string
+	// Expiry is when the token expires. The zero value means it never
+	// does.
+	Expiry time.Time
+}
+
+// HeaderValue returns the value of the Authorization header for t.
+func (t *Token) HeaderValue() string {
+	typ := t.TokenType
+	if typ == "" {
+		typ = "Bearer"
+	}
+	return typ + " " + t.AccessToken
+}
+
+// expiresWithin reports whether t expires in less than d.
+func (t *Token) expiresWithin(d time.Duration) bool {
+	return !t.Expiry.IsZero() && time.Now().Add(d).After(t.Expiry)
+}
+
+// TokenSource supplies tokens to a Client.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to the TokenSource interface.
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+// Token calls f.
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// DefaultTokenRefreshWindow is how long before its expiry a token is
+// refreshed, unless changed with WithTokenRefreshWindow. The window is capped
+// at half the lifetime of the token, so short-lived tokens are still reused.
+const DefaultTokenRefreshWindow = time.Minute
+
+// WithTokenSource makes the Client authenticate with tokens from ts. A token
+// is sent as the Authorization header of every request and in the
+// connection_init payload of every subscription. Tokens are cached and
+// refreshed before they expire, and when the server rejects a request with
+// 401 or an invalid-jwt error the token is refreshed and the request retried
+// once. Long running subscriptions reconnect with a fresh token before the
+// current one expires.
+func WithTokenSource(ts TokenSource) ClientOption {
+	return func(c *Client) {
+		window := DefaultTokenRefreshWindow
+		if c.tokens != nil {
+			window = c.tokens.window
+		}
+		c.tokens = &tokenCache{src: ts, window: window}
+	}
+}
+
+// WithTokenRefreshWindow sets how long before its expiry a token from the
+// TokenSource is refreshed. Tokens living less than twice d are refreshed
+// halfway through their lifetime instead.
+func WithTokenRefreshWindow(d time.Duration) ClientOption {
+	return func(c *Client) {
+		if c.tokens == nil {
+			c.tokens = &tokenCache{}
+		}
+		c.tokens.window = d
+	}
+}
+
+// tokenCache holds the current token of a TokenSource.
+type tokenCache struct {
+	src    TokenSource
+	window time.Duration
+
+	mu  sync.Mutex
+	tok *Token
+	// fetched is when tok was fetched.
+	fetched time.Time
+}
+
+// token returns the cached token, fetching a new one if there is none or it
+// is about to expire.
+func (tc *tokenCache) token(ctx context.Context) (*Token, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.tok != nil && !tc.tok.expiresWithin(tc.refreshWindow()) {
+		return tc.tok, nil
+	}
+	fetched := time.Now()
+	tok, err := tc.src.Token(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "graphql: fetching token")
+	}
+	tc.tok, tc.fetched = tok, fetched
+	return tok, nil
+}
+
+// refreshWindow returns how long before its expiry the cached token is
+// refreshed: the configured window, but no more than half its lifetime.
+// tc.mu must be held.
+func (tc *tokenCache) refreshWindow() time.Duration {
+	lifetime := tc.tok.Expiry.Sub(tc.fetched)
+	if lifetime < 0 {
+		return 0
+	}
+	if tc.window > lifetime/2 {
+		return lifetime / 2
+	}
+	return tc.window
+}
+
+// invalidate drops the cached token so the next call fetches a new one.
+func (tc *tokenCache) invalidate() {
+	tc.mu.Lock()
+	tc.tok = nil
+	tc.mu.Unlock()
+}
+
+// refreshAt returns when a connection authenticated with the current token
+// should be re-established, or the zero time if never.
+func (tc *tokenCache) refreshAt() time.Time {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.tok == nil || tc.tok.Expiry.IsZero() {
+		return time.Time{}
+	}
+	return tc.tok.Expiry.Add(-tc.refreshWindow())
+}
+
+func (c *Client) hasTokenSource() bool {
+	return c.tokens != nil && c.tokens.src != nil
+}
+
+// authorize sets the Authorization header from the TokenSource, if any.
+func (c *Client) authorize(ctx context.Context, h http.Header) error {
+	if !c.hasTokenSource() {
+		return nil
+	}
+	tok, err := c.tokens.token(ctx)
+	if err != nil {
+		return err
+	}
+	h.Set("Authorization", tok.HeaderValue())
+	return nil
+}
+
+// isAuthFailure reports whether a response means the token was rejected.
+func isAuthFailure(status int, errs []Error) bool {
+	if status == http.StatusUnauthorized {
+		return true
+	}
+	for _, e := range errs {
+		if e.Code() == "invalid-jwt" {
+			return true
+		}
+	}
+	return false
+}
+
+// isInvalidJWTMessage reports whether a connection_error payload from the
+// server complains about the token: an invalid-jwt code, a JWTExpired
+// message or a 401 status.
+func isInvalidJWTMessage(payload interface{}) bool {
+	switch p := payload.(type) {
+	case string:
+		return isInvalidJWTText(p)
+	case map[string]interface{}:
+		if msg, ok := p["message"].(string); ok && isInvalidJWTText(msg) {
+			return true
+		}
+		if isUnauthorizedStatus(p) {
+			return true
+		}
+		if ext, ok := p["extensions"].(map[string]interface{}); ok {
+			if code, _ := ext["code"].(string); code == "invalid-jwt" {
+				return true
+			}
+			return isUnauthorizedStatus(ext)
+		}
+	}
+	return false
+}
+
+// isInvalidJWTText reports whether an error message from Hasura is about an
+// invalid or expired token, such as "Could not verify JWT: JWTExpired".
+func isInvalidJWTText(s string) bool {
+	return strings.Contains(s, "invalid-jwt") || strings.Contains(s, "JWTExpired")
+}
+
+// isUnauthorizedStatus reports whether m carries a 401 status.
+func isUnauthorizedStatus(m map[string]interface{}) bool {
+	for _, key := range []string{"status", "statusCode"} {
+		if status, ok := m[key].(float64); ok && status == http.StatusUnauthorized {
+			return true
+		}
+	}
+	return false
+}
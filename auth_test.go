@@ -0,0 +1,238 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"golang.org/x/net/websocket"
+)
+
+// newTokenServer returns a stand-in OAuth2 server that issues "token-1",
+// "token-2", ... valid for expiresIn seconds.
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int) {
+	is := is.New(t)
+	var issued int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.NoErr(r.ParseForm())
+		is.Equal(r.PostForm.Get("grant_type"), "client_credentials")
+		if r.PostForm.Get("client_secret") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"access_denied","error_description":"Unauthorized"}`)
+			return
+		}
+		is.Equal(r.PostForm.Get("client_id"), "client")
+		is.Equal(r.PostForm.Get("audience"), "https://hasura.example.com")
+		issued++
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, issued, expiresIn)
+	}))
+	return srv, &issued
+}
+
+func TestTokenSourceRetryOn401(t *testing.T) {
+	is := is.New(t)
+	tokenSrv, issued := newTokenServer(t, 3600)
+	defer tokenSrv.Close()
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithTokenSource(&ClientCredentials{
+		TokenURL:     tokenSrv.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cret",
+		Audience:     "https://hasura.example.com",
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	var resp struct{ Value string }
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), &resp))
+	is.Equal(resp.Value, "some data")
+	is.Equal(calls, 2)
+	is.Equal(*issued, 2)
+
+	// the refreshed token is reused
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), &resp))
+	is.Equal(calls, 3)
+	is.Equal(*issued, 2)
+}
+
+func TestTokenSourceRetriesOnce(t *testing.T) {
+	is := is.New(t)
+	var calls, issued int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"errors":[{"message":"Could not verify JWT: JWTExpired","extensions":{"code":"invalid-jwt"}}]}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithTokenSource(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		issued++
+		return &Token{AccessToken: "expired"}, nil
+	})))
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	err := client.RunCtxRet(ctx, NewRequest("query {}"), nil)
+	is.Equal(err.Error(), "graphql: Could not verify JWT: JWTExpired")
+	is.Equal(calls, 2)
+	is.Equal(issued, 2)
+}
+
+func TestTokenSourceProactiveRefresh(t *testing.T) {
+	is := is.New(t)
+	tokenSrv, issued := newTokenServer(t, 3600)
+	defer tokenSrv.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL,
+		WithTokenRefreshWindow(2*time.Hour),
+		WithTokenSource(&ClientCredentials{
+			TokenURL:     tokenSrv.URL,
+			ClientID:     "client",
+			ClientSecret: "s3cret",
+			Audience:     "https://hasura.example.com",
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	// the window is capped at half the lifetime of the token, so it is
+	// reused
+	is.Equal(*issued, 1)
+}
+
+func TestTokenSourceShortLived(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	var issued int
+	client := NewClient(srv.URL, WithTokenSource(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		issued++
+		return &Token{AccessToken: fmt.Sprint("token-", issued), Expiry: time.Now().Add(200 * time.Millisecond)}, nil
+	})))
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	// the token lives less than the default refresh window, but is not
+	// refetched on every request
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	is.Equal(issued, 1)
+	// it is refreshed halfway through its lifetime
+	time.Sleep(120 * time.Millisecond)
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	is.Equal(issued, 2)
+}
+
+func TestClientCredentialsError(t *testing.T) {
+	is := is.New(t)
+	tokenSrv, _ := newTokenServer(t, 3600)
+	defer tokenSrv.Close()
+	cc := &ClientCredentials{TokenURL: tokenSrv.URL, ClientID: "client", ClientSecret: "wrong"}
+	_, err := cc.Token(context.Background())
+	is.Equal(err.Error(), "oauth2: access_denied: Unauthorized")
+}
+
+func TestTokenSourceSubscription(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var init gowMsg
+		is.NoErr(websocket.JSON.Receive(ws, &init))
+		is.Equal(init.Type, "connection_init")
+		headers := init.Payload.(map[string]interface{})["headers"].(map[string]interface{})
+		is.Equal(headers["Authorization"], "Bearer abc")
+		is.Equal(ws.Request().Header.Get("Authorization"), "Bearer abc")
+		websocket.JSON.Send(ws, gowMsg{Type: "connection_ack"})
+		var start gowMsg
+		is.NoErr(websocket.JSON.Receive(ws, &start))
+		websocket.JSON.Send(ws, gowMsg{Type: "data", Id: start.Id, Payload: map[string]interface{}{"data": map[string]interface{}{"value": 1}}})
+		websocket.JSON.Send(ws, gowMsg{Type: "complete", Id: start.Id})
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithTokenSource(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return &Token{AccessToken: "abc"}, nil
+	})))
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(context.Background(), NewRequest("subscription { value }"), events)
+	var got []SubscriptionEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	is.Equal(len(got), 1)
+	is.NoErr(got[0].Err)
+	is.Equal(string(got[0].Data), `{"value":1}`)
+}
+
+func TestIsInvalidJWTMessage(t *testing.T) {
+	is := is.New(t)
+	for _, tc := range []struct {
+		payload string
+		want    bool
+	}{
+		{`"cannot start as connection_init failed with : Could not verify JWT: JWTExpired"`, true},
+		{`{"message":"Could not verify JWT: JWTExpired"}`, true},
+		{`{"message":"bad token","extensions":{"code":"invalid-jwt"}}`, true},
+		{`{"message":"unauthorized","extensions":{"statusCode":401}}`, true},
+		{`{"message":"unauthorized","status":401}`, true},
+		{`{"message":"JWT claims are missing the x-hasura-default-role"}`, false},
+		{`{"message":"field \"JWT\" not found in type: 'query_root'","extensions":{"code":"validation-failed"}}`, false},
+		{`{"message":"forbidden","status":403}`, false},
+		{`"JWT"`, false},
+	} {
+		var payload interface{}
+		is.NoErr(json.Unmarshal([]byte(tc.payload), &payload))
+		is.Equal(isInvalidJWTMessage(payload), tc.want) // tc.payload
+	}
+}
+
+func TestTokenSourceSubscriptionRejected(t *testing.T) {
+	is := is.New(t)
+	var conns int
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		conns++
+		var m gowMsg
+		is.NoErr(websocket.JSON.Receive(ws, &m)) // connection_init
+		token := m.Payload.(map[string]interface{})["headers"].(map[string]interface{})["Authorization"]
+		if token != "Bearer token-2" {
+			websocket.JSON.Send(ws, gowMsg{Type: "connection_error", Payload: "cannot start as connection_init failed with : Could not verify JWT: JWTExpired"})
+			return
+		}
+		websocket.JSON.Send(ws, gowMsg{Type: "connection_ack"})
+		is.NoErr(websocket.JSON.Receive(ws, &m)) // start
+		websocket.JSON.Send(ws, gowMsg{Type: "complete", Id: m.Id})
+	}))
+	defer srv.Close()
+
+	var issued int
+	client := NewClient(srv.URL, WithTokenSource(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		issued++
+		return &Token{AccessToken: fmt.Sprint("token-", issued)}, nil
+	})))
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(context.Background(), NewRequest("subscription { value }"), events)
+	for ev := range events {
+		is.NoErr(ev.Err)
+	}
+	is.Equal(conns, 2)
+	is.Equal(issued, 2)
+}
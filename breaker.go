@@ -0,0 +1,242 @@
+package graphqlc
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned without contacting the server while the
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("graphql: circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails all requests with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen lets a few probe requests through to decide whether
+	// to close or open again.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "state(" + strconv.Itoa(int(s)) + ")"
+}
+
+// CircuitBreaker configures the circuit breaker installed by
+// WithCircuitBreaker. Zero fields take their documented defaults.
+//
+// Network errors and 5xx responses count as failures. GraphQL errors and
+// cancelled requests do not.
+type CircuitBreaker struct {
+	// FailureRate is the fraction of failed requests, between 0 and 1, at
+	// which the breaker opens. Defaults to 0.5.
+	FailureRate float64
+	// MinRequests is the number of requests in a window before the failure
+	// rate is considered. Defaults to 10.
+	MinRequests int
+	// Window is the period over which the failure rate is measured.
+	// Defaults to 10 seconds.
+	Window time.Duration
+	// OpenTimeout is how long the breaker stays open before letting probe
+	// requests through. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of probe requests that must succeed for
+	// the breaker to close again. Defaults to 1.
+	HalfOpenProbes int
+}
+
+// WithCircuitBreaker makes the Client fail fast with ErrCircuitOpen while
+// the server is failing, instead of waiting for every request to time out.
+// State transitions are reported to Hooks.CircuitStateChange.
+func WithCircuitBreaker(cb CircuitBreaker) ClientOption {
+	return func(c *Client) {
+		if cb.FailureRate <= 0 {
+			cb.FailureRate = 0.5
+		}
+		if cb.MinRequests <= 0 {
+			cb.MinRequests = 10
+		}
+		if cb.Window <= 0 {
+			cb.Window = 10 * time.Second
+		}
+		if cb.OpenTimeout <= 0 {
+			cb.OpenTimeout = 30 * time.Second
+		}
+		if cb.HalfOpenProbes <= 0 {
+			cb.HalfOpenProbes = 1
+		}
+		c.breakerConfig = &cb
+		c.breaker = c.newBreaker(c.Endpoint)
+	}
+}
+
+func (c *Client) newBreaker(endpoint string) *breaker {
+	if c.breakerConfig == nil {
+		return nil
+	}
+	return &breaker{
+		cfg: *c.breakerConfig,
+		onChange: func(from, to BreakerState) {
+			c.log(LevelWarn, "circuit breaker state changed",
+				Field{"endpoint", endpoint}, Field{"from", from}, Field{"to", to})
+			if c.Hooks != nil && c.Hooks.CircuitStateChange != nil {
+				c.Hooks.CircuitStateChange(endpoint, from, to)
+			}
+		},
+	}
+}
+
+// breaker is a failure rate based circuit breaker.
+type breaker struct {
+	cfg      CircuitBreaker
+	onChange func(from, to BreakerState)
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  uint64
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+}
+
+// State returns the current state of the breaker.
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow reports whether a request may be sent. The returned generation must
+// be passed to record once the request has finished.
+func (b *breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	now := time.Now()
+	var from BreakerState
+	changed := false
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.cfg.OpenTimeout {
+			b.mu.Unlock()
+			return 0, ErrCircuitOpen
+		}
+		from, changed = b.state, true
+		b.setState(BreakerHalfOpen, now)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			b.mu.Unlock()
+			if changed {
+				b.onChange(from, BreakerHalfOpen)
+			}
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	}
+	gen := b.generation
+	b.mu.Unlock()
+	if changed {
+		b.onChange(from, BreakerHalfOpen)
+	}
+	return gen, nil
+}
+
+// record records the outcome of a request allowed in generation gen.
+func (b *breaker) record(gen uint64, failed bool) {
+	b.mu.Lock()
+	if gen != b.generation {
+		// the breaker changed state since the request was allowed
+		b.mu.Unlock()
+		return
+	}
+	from := b.state
+	now := time.Now()
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.setState(BreakerOpen, now)
+		} else if b.successes++; b.successes >= b.cfg.HalfOpenProbes {
+			b.setState(BreakerClosed, now)
+		}
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= b.cfg.FailureRate {
+			b.setState(BreakerOpen, now)
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	if from != to {
+		b.onChange(from, to)
+	}
+}
+
+// cancel gives back a request allowed in generation gen that was never
+// sent.
+func (b *breaker) cancel(gen uint64) {
+	b.mu.Lock()
+	if gen == b.generation && b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	b.mu.Unlock()
+}
+
+// setState moves the breaker to state. It must be called with b.mu held.
+func (b *breaker) setState(state BreakerState, now time.Time) {
+	b.state = state
+	b.generation++
+	switch state {
+	case BreakerOpen:
+		b.openedAt = now
+	case BreakerHalfOpen:
+		b.probes, b.successes = 0, 0
+	case BreakerClosed:
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	}
+}
+
+// CircuitState returns the state of the Client's circuit breaker, or
+// BreakerClosed if it has none.
+func (c *Client) CircuitState() BreakerState {
+	if c.breaker == nil {
+		return BreakerClosed
+	}
+	return c.breaker.State()
+}
+
+// isBreakerFailure reports whether the outcome of a request indicates the
+// server is unhealthy.
+func isBreakerFailure(ctx context.Context, res *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() != context.Canceled
+	}
+	return res.StatusCode >= 500
+}
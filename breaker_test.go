@@ -0,0 +1,88 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	healthy := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	type transition struct{ from, to BreakerState }
+	var transitions []transition
+	client := NewClient(srv.URL, WithCircuitBreaker(CircuitBreaker{
+		FailureRate: 0.5,
+		MinRequests: 4,
+		OpenTimeout: 50 * time.Millisecond,
+	}))
+	client.Hooks = &Hooks{
+		CircuitStateChange: func(endpoint string, from, to BreakerState) {
+			is.Equal(endpoint, srv.URL)
+			transitions = append(transitions, transition{from, to})
+		},
+	}
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		err := client.RunCtxRet(ctx, NewRequest("query {}"), nil)
+		is.True(err != ErrCircuitOpen)
+	}
+	is.Equal(client.CircuitState(), BreakerOpen)
+
+	// open: fail fast without contacting the server
+	err := client.RunCtxRet(ctx, NewRequest("query {}"), nil)
+	is.Equal(err, ErrCircuitOpen)
+	is.Equal(calls, 4)
+
+	// half-open: a failed probe opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	err = client.RunCtxRet(ctx, NewRequest("query {}"), nil)
+	is.True(err != ErrCircuitOpen)
+	is.Equal(calls, 5)
+	is.Equal(client.CircuitState(), BreakerOpen)
+
+	// half-open: a successful probe closes it
+	healthy = true
+	time.Sleep(60 * time.Millisecond)
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	is.Equal(client.CircuitState(), BreakerClosed)
+
+	is.Equal(transitions, []transition{
+		{BreakerClosed, BreakerOpen},
+		{BreakerOpen, BreakerHalfOpen},
+		{BreakerHalfOpen, BreakerOpen},
+		{BreakerOpen, BreakerHalfOpen},
+		{BreakerHalfOpen, BreakerClosed},
+	})
+}
+
+func TestCircuitBreakerIgnoresGraphQLErrors(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"errors":[{"message":"not found"}]}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithCircuitBreaker(CircuitBreaker{MinRequests: 2}))
+	for i := 0; i < 5; i++ {
+		err := client.RunCtxRet(context.Background(), NewRequest("query {}"), nil)
+		is.Equal(err.Error(), "graphql: not found")
+	}
+	is.Equal(client.CircuitState(), BreakerClosed)
+}
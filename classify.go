@@ -0,0 +1,180 @@
+package graphqlc
+
+import (
+	"net/http"
+	"sync"
+)
+
+// ErrorCategory is a broad class of errors, see Classify.
+type ErrorCategory string
+
+// Error categories.
+const (
+	CategoryUnknown         ErrorCategory = ""
+	CategoryNotFound        ErrorCategory = "not_found"
+	CategoryUnauthenticated ErrorCategory = "unauthenticated"
+	CategoryForbidden       ErrorCategory = "forbidden"
+	CategoryValidation      ErrorCategory = "validation"
+	CategoryConflict        ErrorCategory = "conflict"
+	CategoryInternal        ErrorCategory = "internal"
+	CategoryRateLimited     ErrorCategory = "rate_limited"
+)
+
+// defaultErrorCodes maps extensions.code values to categories: the codes of
+// Hasura and Apollo Server, and common conventions.
+var defaultErrorCodes = map[string]ErrorCategory{
+	// Hasura
+	"not-found":               CategoryNotFound,
+	"invalid-jwt":             CategoryUnauthenticated,
+	"jwt-invalid-claims":      CategoryUnauthenticated,
+	"jwt-missing-role-claims": CategoryUnauthenticated,
+	"invalid-headers":         CategoryUnauthenticated,
+	"access-denied":           CategoryForbidden,
+	"permission-denied":       CategoryForbidden,
+	"permission-error":        CategoryForbidden,
+	"validation-failed":       CategoryValidation,
+	"parse-failed":            CategoryValidation,
+	"bad-request":             CategoryValidation,
+	"invalid-params":          CategoryValidation,
+	"data-exception":          CategoryValidation,
+	"constraint-violation":    CategoryConflict,
+	"constraint-error":        CategoryConflict,
+	"already-exists":          CategoryConflict,
+	"unexpected":              CategoryInternal,
+	"postgres-error":          CategoryInternal,
+	"database-error":          CategoryInternal,
+
+	// Apollo Server
+	"UNAUTHENTICATED":              CategoryUnauthenticated,
+	"FORBIDDEN":                    CategoryForbidden,
+	"GRAPHQL_PARSE_FAILED":         CategoryValidation,
+	"GRAPHQL_VALIDATION_FAILED":    CategoryValidation,
+	"BAD_USER_INPUT":               CategoryValidation,
+	"BAD_REQUEST":                  CategoryValidation,
+	"OPERATION_RESOLUTION_FAILURE": CategoryValidation,
+	"INTERNAL_SERVER_ERROR":        CategoryInternal,
+
+	// common conventions
+	"NOT_FOUND":         CategoryNotFound,
+	"CONFLICT":          CategoryConflict,
+	"ALREADY_EXISTS":    CategoryConflict,
+	"RATE_LIMITED":      CategoryRateLimited,
+	"TOO_MANY_REQUESTS": CategoryRateLimited,
+	"THROTTLED":         CategoryRateLimited,
+}
+
+// Classifier sorts errors into categories from the extensions.code of
+// GraphQL errors, see Classify. Libraries mapping codes of their own should
+// use their own Classifier rather than RegisterErrorCode, so that the
+// mapping doesn't change for the rest of the process.
+type Classifier struct {
+	mu    sync.RWMutex
+	codes map[string]ErrorCategory
+}
+
+// NewClassifier returns a Classifier knowing the codes of Hasura and Apollo
+// Server, and common conventions.
+func NewClassifier() *Classifier {
+	c := &Classifier{codes: make(map[string]ErrorCategory, len(defaultErrorCodes))}
+	for code, category := range defaultErrorCodes {
+		c.codes[code] = category
+	}
+	return c
+}
+
+// DefaultClassifier is the Classifier used by Classify and the Is
+// functions.
+var DefaultClassifier = NewClassifier()
+
+// Register makes c put errors with the extensions.code code in category,
+// replacing any previous mapping.
+func (c *Classifier) Register(code string, category ErrorCategory) {
+	c.mu.Lock()
+	if c.codes == nil {
+		c.codes = make(map[string]ErrorCategory)
+	}
+	c.codes[code] = category
+	c.mu.Unlock()
+}
+
+// Classify returns the category of err, from the extensions.code of a
+// GraphQL error if it is registered, or else from the HTTP status of the
+// response. Errors wrapped with github.com/pkg/errors or fmt.Errorf's %w are
+// unwrapped.
+func (c *Classifier) Classify(err error) ErrorCategory {
+	for err != nil {
+		switch e := err.(type) {
+		case Error:
+			c.mu.RLock()
+			category, ok := c.codes[e.Code()]
+			c.mu.RUnlock()
+			if ok {
+				return category
+			}
+			return statusCategory(e.StatusCode)
+		case *StatusError:
+			return statusCategory(e.StatusCode)
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return CategoryUnknown
+		}
+	}
+	return CategoryUnknown
+}
+
+// RegisterErrorCode registers code with DefaultClassifier, which changes
+// Classify for every caller in the process.
+func RegisterErrorCode(code string, category ErrorCategory) {
+	DefaultClassifier.Register(code, category)
+}
+
+// Classify returns the category of err with DefaultClassifier.
+func Classify(err error) ErrorCategory {
+	return DefaultClassifier.Classify(err)
+}
+
+// statusCategory returns the category of an HTTP status.
+func statusCategory(status int) ErrorCategory {
+	switch {
+	case status == http.StatusNotFound:
+		return CategoryNotFound
+	case status == http.StatusUnauthorized:
+		return CategoryUnauthenticated
+	case status == http.StatusForbidden:
+		return CategoryForbidden
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return CategoryValidation
+	case status == http.StatusConflict:
+		return CategoryConflict
+	case status == http.StatusTooManyRequests:
+		return CategoryRateLimited
+	case status >= 500:
+		return CategoryInternal
+	}
+	return CategoryUnknown
+}
+
+// IsNotFound reports whether err is classified as CategoryNotFound.
+func IsNotFound(err error) bool { return Classify(err) == CategoryNotFound }
+
+// IsUnauthenticated reports whether err is classified as
+// CategoryUnauthenticated.
+func IsUnauthenticated(err error) bool { return Classify(err) == CategoryUnauthenticated }
+
+// IsForbidden reports whether err is classified as CategoryForbidden.
+func IsForbidden(err error) bool { return Classify(err) == CategoryForbidden }
+
+// IsValidation reports whether err is classified as CategoryValidation.
+func IsValidation(err error) bool { return Classify(err) == CategoryValidation }
+
+// IsConflict reports whether err is classified as CategoryConflict.
+func IsConflict(err error) bool { return Classify(err) == CategoryConflict }
+
+// IsInternal reports whether err is classified as CategoryInternal.
+func IsInternal(err error) bool { return Classify(err) == CategoryInternal }
+
+// IsRateLimited reports whether err is classified as CategoryRateLimited.
+func IsRateLimited(err error) bool { return Classify(err) == CategoryRateLimited }
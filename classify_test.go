@@ -0,0 +1,71 @@
+package graphqlc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tt := range []struct {
+		status int
+		body   string
+		want   ErrorCategory
+	}{
+		{200, `{"errors":[{"message":"no user","extensions":{"code":"not-found"}}]}`, CategoryNotFound},
+		{200, `{"errors":[{"message":"Could not verify JWT","extensions":{"code":"invalid-jwt"}}]}`, CategoryUnauthenticated},
+		{200, `{"errors":[{"message":"denied","extensions":{"code":"permission-error"}}]}`, CategoryForbidden},
+		{200, `{"errors":[{"message":"duplicate key","extensions":{"code":"constraint-violation"}}]}`, CategoryConflict},
+		{200, `{"errors":[{"message":"bad","extensions":{"code":"GRAPHQL_VALIDATION_FAILED"}}]}`, CategoryValidation},
+		{200, `{"errors":[{"message":"who?","extensions":{"code":"UNAUTHENTICATED"}}]}`, CategoryUnauthenticated},
+		{200, `{"errors":[{"message":"oops","extensions":{"code":"INTERNAL_SERVER_ERROR"}}]}`, CategoryInternal},
+		{200, `{"errors":[{"message":"oops","extensions":{"code":"SOMETHING_ELSE"}}]}`, CategoryUnknown},
+		{429, `{"errors":[{"message":"slow down"}]}`, CategoryRateLimited},
+		{403, `forbidden`, CategoryForbidden},
+		{502, `bad gateway`, CategoryInternal},
+	} {
+		t.Run(tt.body, func(t *testing.T) {
+			is := is.New(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			err := NewClient(srv.URL).RunCtxRet(context.Background(), NewRequest(`{ user { id } }`), nil)
+			is.True(err != nil)
+			is.Equal(Classify(err), tt.want)
+			is.Equal(Classify(errors.Wrap(err, "loading user")), tt.want)
+			is.Equal(Classify(fmt.Errorf("loading user: %w", err)), tt.want)
+		})
+	}
+}
+
+func TestClassifyHelpers(t *testing.T) {
+	is := is.New(t)
+	is.True(IsUnauthenticated(&StatusError{StatusCode: http.StatusUnauthorized}))
+	is.True(IsNotFound(Error{Message: "gone", StatusCode: http.StatusNotFound}))
+	is.True(!IsNotFound(errors.New("gone")))
+	is.Equal(Classify(nil), CategoryUnknown)
+
+	err := Error{Message: "quota", Extensions: map[string]interface{}{"code": "QUOTA_EXCEEDED"}}
+	c := NewClassifier()
+	c.Register("QUOTA_EXCEEDED", CategoryRateLimited)
+	is.Equal(c.Classify(err), CategoryRateLimited)
+	is.Equal(c.Classify(Error{Extensions: map[string]interface{}{"code": "not-found"}}), CategoryNotFound)
+	is.True(!IsRateLimited(err)) // other classifiers are unchanged
+
+	t.Cleanup(func() {
+		DefaultClassifier.mu.Lock()
+		delete(DefaultClassifier.codes, "QUOTA_EXCEEDED")
+		DefaultClassifier.mu.Unlock()
+	})
+	RegisterErrorCode("QUOTA_EXCEEDED", CategoryRateLimited)
+	is.True(IsRateLimited(err))
+	is.Equal(NewClassifier().Classify(err), CategoryUnknown)
+}
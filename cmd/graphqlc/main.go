@@ -0,0 +1,230 @@
+// Command graphqlc runs GraphQL operations from the command line.
+//
+//  graphqlc -endpoint https://example.com/graphql -var id=1 query.graphql
+//  echo '{ users { name } }' | graphqlc -endpoint https://example.com/graphql
+//  graphqlc subscribe -max-events 10 -endpoint https://example.com/graphql on_message.graphql
+//
+// The query is read from the file given as argument, or from stdin if there
+// is none or it is "-". Variables come from a JSON file (-vars) and from
+// -var key=value flags, where value is parsed as JSON if possible and taken
+// as a string otherwise. Headers come from -H "Key: Value" flags and from
+// environment variables named GRAPHQLC_HEADER_<NAME>, with underscores in
+// the name turned into dashes. The endpoint can also be set with
+// GRAPHQLC_ENDPOINT.
+//
+// The data of the response is printed as indented JSON, or compact JSON with
+// -compact. graphqlc exits with status 1 if the server returns GraphQL
+// errors or the request fails, and 2 on usage errors.
+//
+// The subscribe command runs a subscription and writes each event to stdout
+// as a line of JSON, {"data":...} or {"error":"..."}, until the server
+// completes it, -max-events events have arrived, -timeout expires or
+// graphqlc is interrupted. It exits with status 1 if an error event was
+// written, or if -max-events is set and fewer events arrived.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/leonardacademy/graphqlc"
+	"github.com/pkg/errors"
+)
+
+const (
+	envEndpoint     = "GRAPHQLC_ENDPOINT"
+	envHeaderPrefix = "GRAPHQLC_HEADER_"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Environ())
+	stop()
+	os.Exit(code)
+}
+
+// listFlag collects the values of a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ", ") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+// options are the flags shared by every command.
+type options struct {
+	endpoint string
+	varsFile string
+	vars     listFlag
+	headers  listFlag
+	compact  bool
+	timeout  time.Duration
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.endpoint, "endpoint", "", "GraphQL endpoint URL (default $"+envEndpoint+")")
+	fs.StringVar(&o.varsFile, "vars", "", "JSON file with the variables")
+	fs.Var(&o.vars, "var", "variable as key=value, repeatable")
+	fs.Var(&o.headers, "H", `request header as "Key: Value", repeatable`)
+	fs.BoolVar(&o.compact, "compact", false, "print compact JSON")
+	fs.DurationVar(&o.timeout, "timeout", 0, "give up after this long (default no limit)")
+}
+
+// errUsage is returned for invalid invocations. The problem has already
+// been reported.
+var errUsage = errors.New("usage")
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, env []string) int {
+	if len(args) > 0 && args[0] == "subscribe" {
+		return runSubscribe(ctx, args[1:], stdin, stdout, stderr, env)
+	}
+	fs := flag.NewFlagSet("graphqlc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: graphqlc [flags] [query.graphql]")
+		fmt.Fprintln(stderr, "       graphqlc subscribe [flags] [subscription.graphql]")
+		fs.PrintDefaults()
+	}
+	var opts options
+	opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	client, req, err := opts.request(fs, stdin, stderr, env)
+	if err == errUsage {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "graphqlc: %v\n", err)
+		return 1
+	}
+	ctx, cancel := opts.context(ctx)
+	defer cancel()
+	var data json.RawMessage
+	err = client.RunCtxRet(ctx, req, &data)
+	if len(data) > 0 && string(data) != "null" {
+		if perr := opts.print(stdout, data); perr != nil && err == nil {
+			err = perr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "graphqlc: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// request builds the client and request from the parsed flags.
+func (o *options) request(fs *flag.FlagSet, stdin io.Reader, stderr io.Writer, env []string) (*graphqlc.Client, *graphqlc.Request, error) {
+	if o.endpoint == "" {
+		o.endpoint = lookupEnv(env, envEndpoint)
+	}
+	if o.endpoint == "" {
+		fmt.Fprintln(stderr, "graphqlc: no endpoint, set -endpoint or $"+envEndpoint)
+		return nil, nil, errUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return nil, nil, errUsage
+	}
+	var query []byte
+	var err error
+	if file := fs.Arg(0); file != "" && file != "-" {
+		query, err = ioutil.ReadFile(file)
+	} else {
+		query, err = ioutil.ReadAll(stdin)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bytes.TrimSpace(query)) == 0 {
+		return nil, nil, errors.New("empty query")
+	}
+	req := graphqlc.NewRequest(string(query))
+	if o.varsFile != "" {
+		b, err := ioutil.ReadFile(o.varsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		var vars map[string]interface{}
+		if err := json.Unmarshal(b, &vars); err != nil {
+			return nil, nil, errors.Errorf("reading %s: %v", o.varsFile, err)
+		}
+		for key, value := range vars {
+			req.Var(key, value)
+		}
+	}
+	for _, v := range o.vars {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, nil, errors.Errorf("invalid -var %q, want key=value", v)
+		}
+		req.Var(kv[0], parseValue(kv[1]))
+	}
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 && strings.HasPrefix(kv[0], envHeaderPrefix) && len(kv[0]) > len(envHeaderPrefix) {
+			name := strings.Replace(kv[0][len(envHeaderPrefix):], "_", "-", -1)
+			req.Header.Set(name, kv[1])
+		}
+	}
+	for _, h := range o.headers {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, nil, errors.Errorf("invalid -H %q, want \"Key: Value\"", h)
+		}
+		req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+	return graphqlc.NewClient(o.endpoint), req, nil
+}
+
+// context returns the context for the operation, honouring -timeout.
+func (o *options) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeout > 0 {
+		return context.WithTimeout(ctx, o.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// print writes a JSON value on its own line, indented unless -compact is
+// set.
+func (o *options) print(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	var err error
+	if o.compact {
+		err = json.Compact(&buf, data)
+	} else {
+		err = json.Indent(&buf, data, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// parseValue parses a -var value as JSON, falling back to a string.
+func parseValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+func lookupEnv(env []string, key string) string {
+	for _, e := range env {
+		if strings.HasPrefix(e, key+"=") {
+			return e[len(key)+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leonardacademy/graphqlc/graphqlctest"
+	"github.com/matryer/is"
+)
+
+func TestRun(t *testing.T) {
+	is := is.New(t)
+	srv := graphqlctest.NewServer(t)
+	srv.Expect().
+		OperationName("GetUser").
+		Variables(map[string]interface{}{"id": 1, "name": "bob", "active": true}).
+		Match(func(r *graphqlctest.RecordedRequest) bool {
+			return r.Header.Get("Authorization") == "Bearer x" && r.Header.Get("X-Request-Id") == "42"
+		}).
+		RespondData(map[string]interface{}{"user": map[string]interface{}{"id": 1}})
+
+	dir := t.TempDir()
+	query := filepath.Join(dir, "query.graphql")
+	is.NoErr(ioutil.WriteFile(query, []byte(`query GetUser($id: Int) { user(id: $id) { id } }`), 0644))
+	vars := filepath.Join(dir, "vars.json")
+	is.NoErr(ioutil.WriteFile(vars, []byte(`{"id": 2, "active": true}`), 0644))
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(),
+		[]string{"-vars", vars, "-var", "id=1", "-var", "name=bob", "-H", "X-Request-Id: 42", query},
+		strings.NewReader(""), &stdout, &stderr,
+		[]string{"GRAPHQLC_ENDPOINT=" + srv.URL, "GRAPHQLC_HEADER_AUTHORIZATION=Bearer x"},
+	)
+	is.Equal(stderr.String(), "")
+	is.Equal(code, 0)
+	is.Equal(stdout.String(), "{\n  \"user\": {\n    \"id\": 1\n  }\n}\n")
+}
+
+func TestRunStdinCompact(t *testing.T) {
+	is := is.New(t)
+	srv := graphqlctest.NewServer(t)
+	srv.Expect().
+		Query(`{ users { name } }`).
+		RespondData(map[string]interface{}{"users": []interface{}{map[string]interface{}{"name": "bob"}}})
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-endpoint", srv.URL, "-compact"}, strings.NewReader("{ users { name } }\n"), &stdout, &stderr, nil)
+	is.Equal(code, 0)
+	is.Equal(stdout.String(), `{"users":[{"name":"bob"}]}`+"\n")
+}
+
+func TestRunErrors(t *testing.T) {
+	is := is.New(t)
+	srv := graphqlctest.NewServer(t)
+	srv.Expect().
+		RespondData(map[string]interface{}{"user": nil}).
+		RespondErrors(graphqlctest.Error{Message: "not found"})
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-endpoint", srv.URL}, strings.NewReader("{ user { id } }"), &stdout, &stderr, nil)
+	is.Equal(code, 1)
+	is.Equal(stderr.String(), "graphqlc: graphql: not found\n")
+	is.Equal(stdout.String(), "{\n  \"user\": null\n}\n")
+
+	stdout.Reset()
+	stderr.Reset()
+	code = run(context.Background(), []string{"-var", "nokey"}, strings.NewReader("{ x }"), &stdout, &stderr, nil)
+	is.Equal(code, 2)
+	is.True(strings.Contains(stderr.String(), "no endpoint"))
+
+	stderr.Reset()
+	code = run(context.Background(), []string{"-endpoint", srv.URL, "-var", "nokey"}, strings.NewReader("{ x }"), &stdout, &stderr, nil)
+	is.Equal(code, 1)
+	is.Equal(stderr.String(), "graphqlc: invalid -var \"nokey\", want key=value\n")
+}
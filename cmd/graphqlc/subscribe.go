@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/leonardacademy/graphqlc"
+)
+
+// event is an NDJSON line written by the subscribe command.
+type event struct {
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+func runSubscribe(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, env []string) int {
+	fs := flag.NewFlagSet("graphqlc subscribe", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: graphqlc subscribe [flags] [subscription.graphql]")
+		fs.PrintDefaults()
+	}
+	var opts options
+	opts.register(fs)
+	maxEvents := fs.Int("max-events", 0, "stop after this many events (default no limit)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	client, req, err := opts.request(fs, stdin, stderr, env)
+	if err == errUsage {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "graphqlc: %v\n", err)
+		return 1
+	}
+	ctx, cancel := opts.context(ctx)
+	defer cancel()
+	events := make(chan graphqlc.SubscriptionEvent)
+	go client.Subscribe(ctx, req, events)
+
+	enc := json.NewEncoder(stdout)
+	code, n := 0, 0
+	for ev := range events {
+		if ctx.Err() != nil {
+			// the subscription is being torn down
+			continue
+		}
+		line := event{Data: ev.Data}
+		if ev.Err != nil {
+			line = event{Error: ev.Err.Error()}
+			code = 1
+		}
+		if err := enc.Encode(line); err != nil {
+			fmt.Fprintf(stderr, "graphqlc: %v\n", err)
+			cancel()
+			code = 1
+			continue
+		}
+		n++
+		if *maxEvents > 0 && n >= *maxEvents {
+			cancel()
+		}
+	}
+	if *maxEvents > 0 && n < *maxEvents {
+		fmt.Fprintf(stderr, "graphqlc: got %d event(s), want %d\n", n, *maxEvents)
+		code = 1
+	}
+	return code
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leonardacademy/graphqlc/graphqlctest"
+	"github.com/matryer/is"
+)
+
+func TestSubscribe(t *testing.T) {
+	is := is.New(t)
+	srv := graphqlctest.NewSubscriptionServer(t)
+	srv.Script().
+		Ack().
+		Data(map[string]interface{}{"n": 1}).
+		Error(map[string]interface{}{"message": "boom"}).
+		Data(map[string]interface{}{"n": 2}).
+		Complete()
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"subscribe", "-endpoint", srv.URL, "-var", "min=1"},
+		strings.NewReader("subscription ($min: Int) { n(min: $min) }"), &stdout, &stderr, nil)
+	is.Equal(code, 1) // an error event was written
+	is.Equal(stdout.String(), `{"data":{"n":1}}
+{"error":"{\"message\":\"boom\"}"}
+{"data":{"n":2}}
+`)
+	starts := srv.Await("start", 1, time.Second)
+	is.True(strings.Contains(string(starts[0].Payload), `"variables":{"min":1}`))
+}
+
+func TestSubscribeMaxEvents(t *testing.T) {
+	is := is.New(t)
+	srv := graphqlctest.NewSubscriptionServer(t)
+	srv.Script().
+		Ack().
+		Data(map[string]interface{}{"n": 1}).
+		Data(map[string]interface{}{"n": 2}).
+		Data(map[string]interface{}{"n": 3})
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"subscribe", "-endpoint", srv.URL, "-max-events", "2"},
+		strings.NewReader("subscription { n }"), &stdout, &stderr, nil)
+	is.Equal(stderr.String(), "")
+	is.Equal(code, 0)
+	is.Equal(stdout.String(), "{\"data\":{\"n\":1}}\n{\"data\":{\"n\":2}}\n")
+	srv.Await("stop", 1, time.Second)
+}
+
+func TestSubscribeTimeout(t *testing.T) {
+	is := is.New(t)
+	srv := graphqlctest.NewSubscriptionServer(t)
+	srv.Script().Ack().Data(map[string]interface{}{"n": 1})
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"subscribe", "-endpoint", srv.URL, "-timeout", "100ms"},
+		strings.NewReader("subscription { n }"), &stdout, &stderr, nil)
+	is.Equal(code, 0)
+	is.Equal(stdout.String(), "{\"data\":{\"n\":1}}\n")
+
+	// fewer events than -max-events before the timeout is a failure
+	stdout.Reset()
+	code = run(context.Background(), []string{"subscribe", "-endpoint", srv.URL, "-timeout", "100ms", "-max-events", "2"},
+		strings.NewReader("subscription { n }"), &stdout, &stderr, nil)
+	is.Equal(code, 1)
+	is.Equal(stderr.String(), "graphqlc: got 1 event(s), want 2\n")
+}
@@ -0,0 +1,116 @@
+package graphqlc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCompressionMinSize is the smallest request body that is compressed
+// unless Compression.MinSize is set.
+const DefaultCompressionMinSize = 1024
+
+// Compression configures request and response compression, see
+// WithCompression.
+type Compression struct {
+	// MinSize is the smallest request body, in bytes, that is gzipped.
+	// Defaults to DefaultCompressionMinSize.
+	MinSize int
+	// Level is the gzip compression level. Defaults to
+	// gzip.DefaultCompression.
+	Level int
+}
+
+// WithCompression gzips request bodies of at least MinSize bytes, sent with
+// Content-Encoding: gzip, and asks the server for gzip or deflate compressed
+// responses. Compressed responses are decompressed whether or not the
+// HttpClient's transport does it itself. Compression ratios are logged at
+// the debug level.
+func WithCompression(cfg Compression) ClientOption {
+	return func(c *Client) {
+		if cfg.MinSize <= 0 {
+			cfg.MinSize = DefaultCompressionMinSize
+		}
+		if cfg.Level == 0 {
+			cfg.Level = gzip.DefaultCompression
+		}
+		c.compression = &cfg
+	}
+}
+
+// compress gzips body if compression is enabled and it is large enough.
+func (c *Client) compress(body *payload) error {
+	if c.compression == nil || len(body.data) < c.compression.MinSize {
+		return nil
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, c.compression.Level)
+	if err != nil {
+		return errors.Wrap(err, "compressing body")
+	}
+	if _, err := w.Write(body.data); err != nil {
+		return errors.Wrap(err, "compressing body")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "compressing body")
+	}
+	c.debug("request body compressed",
+		Field{"size", len(body.data)},
+		Field{"compressed", buf.Len()},
+		Field{"ratio", ratio(buf.Len(), len(body.data))})
+	body.data = buf.Bytes()
+	body.contentEncoding = "gzip"
+	return nil
+}
+
+// decompress returns the decoded body of res according to its
+// Content-Encoding. res is updated to describe the decoded body.
+func (c *Client) decompress(res *http.Response, body []byte) ([]byte, error) {
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// deflate is meant to be zlib wrapped, but some servers send raw
+		// deflate data
+		if r, err = zlib.NewReader(bytes.NewReader(body)); err != nil {
+			r, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	default:
+		return body, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "decompressing response")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "decompressing response")
+	}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+	c.debug("response body decompressed",
+		Field{"encoding", encoding},
+		Field{"size", len(data)},
+		Field{"compressed", len(body)},
+		Field{"ratio", ratio(len(body), len(data))})
+	return data, nil
+}
+
+// ratio returns compressed/size rounded to two decimals.
+func ratio(compressed, size int) float64 {
+	if size == 0 {
+		return 0
+	}
+	return float64(compressed*100/size) / 100
+}
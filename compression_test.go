@@ -0,0 +1,83 @@
+package graphqlc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestCompression(t *testing.T) {
+	is := is.New(t)
+	var gotEncoding, gotAccept, gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Content-Encoding")
+		gotAccept = r.Header.Get("Accept-Encoding")
+		body := io.Reader(r.Body)
+		if gotEncoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			is.NoErr(err)
+			body = zr
+		}
+		b, err := ioutil.ReadAll(body)
+		is.NoErr(err)
+		gotQuery = string(b)
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, `{"data":{"name":"`+strings.Repeat("a", 100)+`"}}`)
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	var entries []string
+	client := NewClient(srv.URL, WithCompression(Compression{MinSize: 100}))
+	// a transport that leaves decompression to the client
+	client.HttpClient = &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	client.Logger = LoggerFunc(func(level Level, msg string, fields ...Field) {
+		if strings.Contains(msg, "compressed") {
+			entries = append(entries, msg)
+		}
+	})
+
+	ctx := context.Background()
+	var resp struct{ Name string }
+	req := NewRequest(`query { name }`)
+	req.Var("filler", strings.Repeat("x", 200))
+	is.NoErr(client.RunCtxRet(ctx, req, &resp))
+	is.Equal(resp.Name, strings.Repeat("a", 100))
+	is.Equal(gotEncoding, "gzip")
+	is.Equal(gotAccept, "gzip, deflate")
+	is.True(strings.Contains(gotQuery, `"query":"query { name }"`))
+	is.Equal(entries, []string{"request body compressed", "response body decompressed"})
+
+	// small bodies are sent as they are
+	is.NoErr(client.RunCtxRet(ctx, NewRequest(`query { name }`), &resp))
+	is.Equal(gotEncoding, "")
+}
+
+func TestDecompressDeflate(t *testing.T) {
+	is := is.New(t)
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	is.NoErr(err)
+	io.WriteString(fw, `{"data":{"name":"raw"}}`)
+	fw.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "deflate")
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	var resp struct{ Name string }
+	is.NoErr(client.RunCtxRet(context.Background(), NewRequest(`query { name }`), &resp))
+	is.Equal(resp.Name, "raw")
+}
@@ -0,0 +1,78 @@
+package graphqlc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// At returns a response target decoding the value at path in the data of the
+// response into v, sparing a wrapper type for the root fields:
+//
+//  var profile Profile
+//  err := client.RunCtxRet(ctx, req, graphqlc.At("users_by_pk.profile", &profile))
+//
+// Path is a dotted list of keys, with list indexes as keys or in brackets,
+// such as "insert_foo.returning[0]". A leading "data." is ignored. If a value
+// along the path is null, v is left untouched.
+func At(path string, v interface{}) interface{} {
+	return &pathTarget{path: strings.TrimPrefix(path, "data."), v: v}
+}
+
+type pathTarget struct {
+	path string
+	v    interface{}
+}
+
+func (t *pathTarget) UnmarshalJSON(data []byte) error {
+	if isNull(data) {
+		return nil
+	}
+	raw, err := lookupPath(data, t.path)
+	if err != nil {
+		return err
+	}
+	if isNull(raw) {
+		return nil
+	}
+	return errors.Wrapf(json.Unmarshal(raw, t.v), "graphql: decoding %q", t.path)
+}
+
+// Fields is a response target decoding each root field of the data, by name
+// or alias, into its own value:
+//
+//  var user User
+//  var orgs []Org
+//  err := client.RunCtxRet(ctx, req, graphqlc.Fields{"user": &user, "orgs": &orgs})
+//
+// Values may be At targets to decode a path within the field. Root fields
+// without a target are ignored; an error is returned if a target has no
+// field.
+type Fields map[string]interface{}
+
+func (f Fields) UnmarshalJSON(data []byte) error {
+	if isNull(data) {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for name, v := range f {
+		raw, ok := fields[name]
+		if !ok {
+			return errors.Errorf("graphql: no %q in response", name)
+		}
+		if err := json.Unmarshal(raw, v); err != nil {
+			return errors.Wrapf(err, "graphql: decoding %q", name)
+		}
+	}
+	return nil
+}
+
+func isNull(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) == 0 || bytes.Equal(data, []byte("null"))
+}
@@ -0,0 +1,62 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestDecodeTargets(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{
+			"users_by_pk":{"profile":{"name":"Mat","age":30}},
+			"insert_foo":{"returning":[{"id":1},{"id":2}]},
+			"deleted":null
+		}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+	ctx := context.Background()
+	req := NewRequest(`{ users_by_pk(id: 1) { profile { name age } } }`)
+
+	type Profile struct {
+		Name string
+		Age  int
+	}
+	var profile Profile
+	is.NoErr(client.RunCtxRet(ctx, req, At("data.users_by_pk.profile", &profile)))
+	is.Equal(profile, Profile{Name: "Mat", Age: 30})
+
+	var id struct{ ID int }
+	is.NoErr(client.RunCtxRet(ctx, req, At("insert_foo.returning[1]", &id)))
+	is.Equal(id.ID, 2)
+
+	name := "untouched"
+	is.NoErr(client.RunCtxRet(ctx, req, At("deleted.name", &name)))
+	is.Equal(name, "untouched")
+
+	err := client.RunCtxRet(ctx, req, At("users_by_pk.missing", &name))
+	is.Equal(err.Error(), `decoding response: graphql: no "users_by_pk.missing" in response`)
+	err = client.RunCtxRet(ctx, req, At("users_by_pk.profile.age", &name))
+	is.Equal(err.Error(), `decoding response: graphql: decoding "users_by_pk.profile.age": json: cannot unmarshal number into Go value of type string`)
+
+	var user struct{ Profile Profile }
+	var first struct{ ID int }
+	var deleted *Profile
+	is.NoErr(client.RunCtxRet(ctx, req, Fields{
+		"users_by_pk": &user,
+		"insert_foo":  At("returning.0", &first),
+		"deleted":     &deleted,
+	}))
+	is.Equal(user.Profile.Name, "Mat")
+	is.Equal(first.ID, 1)
+	is.Equal(deleted, nil)
+
+	err = client.RunCtxRet(ctx, req, Fields{"nope": &user})
+	is.Equal(err.Error(), `decoding response: graphql: no "nope" in response`)
+}
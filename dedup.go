@@ -0,0 +1,116 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// WithDeduplication makes identical queries in flight at the same time share
+// a single round trip. Queries are identical if their normalized text,
+// variables and the values of the given headers are the same; headers that
+// change the response, such as the role or the tenant, must be listed. Each
+// caller decodes the response into its own value. Mutations and requests
+// with files are always sent on their own.
+func WithDeduplication(headers ...string) ClientOption {
+	return func(c *Client) {
+		d := &inflight{calls: make(map[string]*inflightCall)}
+		for _, h := range headers {
+			d.headers = append(d.headers, http.CanonicalHeaderKey(h))
+		}
+		c.dedup = d
+	}
+}
+
+// inflight tracks the deduplicated requests being sent.
+type inflight struct {
+	headers []string
+
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+type inflightCall struct {
+	done chan struct{}
+	res  *http.Response
+	buf  []byte
+	err  error
+	// abandoned is set if the context of the caller sending the request
+	// ended before the response came back.
+	abandoned bool
+}
+
+// sendShared sends the operation, or waits for an identical one in flight
+// and returns a copy of its response.
+func (c *Client) sendShared(ctx context.Context, op *OperationInfo, req *Request, body *payload) (*http.Response, []byte, error) {
+	d := c.dedup
+	if d == nil || op.Type != OperationQuery || len(req.files) > 0 {
+		return c.send(ctx, op, req, body)
+	}
+	key, err := d.key(ctx, c, req)
+	if err != nil {
+		return c.send(ctx, op, req, body)
+	}
+	d.mu.Lock()
+	if call, ok := d.calls[key]; ok {
+		d.mu.Unlock()
+		c.debug("sharing in-flight request", Field{"operation", op.Name})
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		if call.abandoned && ctx.Err() == nil {
+			// the caller that sent the request gave up, not this one
+			return c.send(ctx, op, req, body)
+		}
+		if call.err != nil {
+			return nil, nil, call.err
+		}
+		if r := responseFrom(ctx); r != nil {
+			*r = Response{StatusCode: call.res.StatusCode, Header: call.res.Header.Clone()}
+		}
+		return call.res, append([]byte(nil), call.buf...), nil
+	}
+	call := &inflightCall{done: make(chan struct{})}
+	d.calls[key] = call
+	d.mu.Unlock()
+
+	call.res, call.buf, call.err = c.send(ctx, op, req, body)
+	call.abandoned = call.err != nil && ctx.Err() != nil
+	d.mu.Lock()
+	delete(d.calls, key)
+	d.mu.Unlock()
+	close(call.done)
+	return call.res, call.buf, call.err
+}
+
+// key identifies req, run with ctx, among identical requests.
+func (d *inflight) key(ctx context.Context, c *Client, req *Request) (string, error) {
+	vars, err := json.Marshal(req.vars)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(NormalizeQuery(req.q))
+	b.WriteByte(0)
+	b.Write(vars)
+	for _, name := range d.headers {
+		values := req.Header[name]
+		if values == nil {
+			values = HeaderFromContext(ctx)[name]
+		}
+		if values == nil {
+			values = c.Header[name]
+		}
+		b.WriteByte(0)
+		b.WriteString(name)
+		for _, v := range values {
+			b.WriteByte(0)
+			b.WriteString(v)
+		}
+	}
+	return b.String(), nil
+}
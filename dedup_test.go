@@ -0,0 +1,113 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestDeduplication(t *testing.T) {
+	is := is.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, `{"data":{"user":{"name":"Mat","tags":["a"]}}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithDeduplication("X-Hasura-Role"))
+
+	type user struct {
+		User struct {
+			Name string
+			Tags []string
+		}
+	}
+	run := func(n int, newReq func(i int) *Request) []user {
+		atomic.StoreInt32(&calls, 0)
+		results := make([]user, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				is.NoErr(client.RunCtxRet(context.Background(), newReq(i), &results[i]))
+			}(i)
+		}
+		wg.Wait()
+		return results
+	}
+
+	results := run(5, func(i int) *Request {
+		// formatting differs, the normalized query is the same
+		req := NewRequest("query ($id: Int!) {\n user(id: $id) { name tags }\n}")
+		if i%2 == 0 {
+			req = NewRequest("query ($id: Int!) { user(id: $id) { name tags } }  # comment")
+		}
+		req.Var("id", 1)
+		return req
+	})
+	is.Equal(atomic.LoadInt32(&calls), int32(1))
+	results[0].User.Tags[0] = "changed"
+	for _, r := range results[1:] {
+		is.Equal(r.User.Name, "Mat")
+		is.Equal(r.User.Tags, []string{"a"}) // each caller has its own copy
+	}
+
+	run(3, func(i int) *Request {
+		req := NewRequest(`query ($id: Int!) { user(id: $id) { name } }`)
+		req.Var("id", i)
+		return req
+	})
+	is.Equal(atomic.LoadInt32(&calls), int32(3)) // different variables
+
+	run(2, func(i int) *Request {
+		req := NewRequest(`{ user { name } }`)
+		req.Header.Set("X-Hasura-Role", []string{"user", "admin"}[i])
+		return req
+	})
+	is.Equal(atomic.LoadInt32(&calls), int32(2)) // different role
+
+	run(3, func(i int) *Request {
+		return NewRequest(`mutation { user { name } }`)
+	})
+	is.Equal(atomic.LoadInt32(&calls), int32(3)) // mutations are never shared
+}
+
+func TestDeduplicationCancel(t *testing.T) {
+	is := is.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, `{"data":{"n":1}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithDeduplication())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() { first <- client.RunCtxRet(ctx, NewRequest(`{ n }`), nil) }()
+	time.Sleep(20 * time.Millisecond)
+	second := make(chan error)
+	var resp struct{ N int }
+	go func() { second <- client.RunCtxRet(context.Background(), NewRequest(`{ n }`), &resp) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	is.True(<-first != nil)
+	// the second caller sends its own request when the first one gives up
+	is.NoErr(<-second)
+	is.Equal(resp.N, 1)
+	is.Equal(atomic.LoadInt32(&calls), int32(2))
+}
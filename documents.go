@@ -0,0 +1,281 @@
+package graphqlc
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Documents holds named GraphQL operations loaded from .graphql files, each
+// with the fragments it uses appended.
+//
+//  //go:embed graphql
+//  var files embed.FS
+//
+//  docs, err := graphqlc.LoadDocuments(files, "graphql/*.graphql")
+//  req, err := docs.Request("GetUser")
+//
+// A file can use the fragments of another one by importing it with a
+// comment, the path being relative to the importing file:
+//
+//  #import "./user_fields.graphql"
+type Documents struct {
+	queries map[string]string
+}
+
+// LoadDocuments loads the files of fsys matching patterns, as understood by
+// fs.Glob, along with the files they import. With no patterns, every .graphql
+// and .gql file is loaded. Every operation must be named. An error is
+// returned if a fragment or an operation is defined twice, or if an
+// operation uses a fragment that is not defined in its file or the files it
+// imports.
+func LoadDocuments(fsys fs.FS, patterns ...string) (*Documents, error) {
+	l := &docLoader{fsys: fsys, files: make(map[string]*docFile)}
+	var names []string
+	if len(patterns) == 0 {
+		err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := path.Ext(name); !d.IsDir() && (ext == ".graphql" || ext == ".gql") {
+				names = append(names, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, errors.Errorf("graphql: no documents match %q", pattern)
+		}
+		names = append(names, matches...)
+	}
+	for _, name := range names {
+		if _, err := l.load(name); err != nil {
+			return nil, err
+		}
+	}
+	return l.resolve()
+}
+
+// Operations returns the names of the loaded operations, sorted.
+func (d *Documents) Operations() []string {
+	var names []string
+	for name := range d.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Query returns the text of the named operation followed by the fragments it
+// uses.
+func (d *Documents) Query(name string) (string, bool) {
+	q, ok := d.queries[name]
+	return q, ok
+}
+
+// Request returns a new Request for the named operation.
+func (d *Documents) Request(name string) (*Request, error) {
+	q, ok := d.queries[name]
+	if !ok {
+		return nil, errors.Errorf("graphql: no operation named %q", name)
+	}
+	return NewRequest(q), nil
+}
+
+// definition is an operation or fragment definition in a document.
+type definition struct {
+	kind    string // "fragment" or an operation type
+	name    string
+	text    string
+	file    string
+	spreads []string // names of the fragments spread in it
+}
+
+type docFile struct {
+	name    string
+	defs    []*definition
+	imports []*docFile
+}
+
+type docLoader struct {
+	fsys  fs.FS
+	files map[string]*docFile
+}
+
+// load reads and parses the file name and the files it imports.
+func (l *docLoader) load(name string) (*docFile, error) {
+	name = path.Clean(name)
+	if f, ok := l.files[name]; ok {
+		return f, nil
+	}
+	b, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	f := &docFile{name: name}
+	l.files[name] = f
+	defs, imports, err := parseDocument(string(b))
+	if perr, ok := err.(parseError); ok {
+		return nil, errors.Errorf("graphql: %s: syntax error at offset %d: %s", name, perr.offset, perr.msg)
+	} else if err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+	for _, d := range defs {
+		d.file = name
+	}
+	f.defs = defs
+	for _, imp := range imports {
+		g, err := l.load(path.Join(path.Dir(name), imp))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: importing %q", name, imp)
+		}
+		f.imports = append(f.imports, g)
+	}
+	return f, nil
+}
+
+// resolve checks the loaded definitions and assembles the operations.
+func (l *docLoader) resolve() (*Documents, error) {
+	var files []*docFile
+	for _, f := range l.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+
+	fragments := make(map[string]*definition)
+	operations := make(map[string]*definition)
+	for _, f := range files {
+		for _, d := range f.defs {
+			defs := operations
+			if d.kind == "fragment" {
+				defs = fragments
+			}
+			if d.name == "" {
+				return nil, errors.Errorf("graphql: %s: anonymous %s, operations must be named", f.name, d.kind)
+			}
+			if other, ok := defs[d.name]; ok {
+				return nil, errors.Errorf("graphql: %s %q is defined in both %s and %s", d.kind, d.name, other.file, d.file)
+			}
+			defs[d.name] = d
+		}
+	}
+
+	docs := &Documents{queries: make(map[string]string)}
+	for _, f := range files {
+		visible := make(map[string]*definition)
+		f.visibleFragments(visible, make(map[*docFile]bool))
+		for _, d := range f.defs {
+			used, err := usedFragments(d, visible, fragments)
+			if err != nil {
+				return nil, err
+			}
+			if d.kind == "fragment" {
+				continue
+			}
+			texts := []string{d.text}
+			for _, frag := range used {
+				texts = append(texts, frag.text)
+			}
+			docs.queries[d.name] = strings.Join(texts, "\n\n")
+		}
+	}
+	return docs, nil
+}
+
+// visibleFragments adds the fragments defined in f and the files it imports
+// to visible.
+func (f *docFile) visibleFragments(visible map[string]*definition, seen map[*docFile]bool) {
+	if seen[f] {
+		return
+	}
+	seen[f] = true
+	for _, d := range f.defs {
+		if d.kind == "fragment" {
+			visible[d.name] = d
+		}
+	}
+	for _, imp := range f.imports {
+		imp.visibleFragments(visible, seen)
+	}
+}
+
+// usedFragments returns the fragments d uses, directly or not, in the order
+// they are first spread.
+func usedFragments(d *definition, visible, all map[string]*definition) ([]*definition, error) {
+	var used []*definition
+	seen := map[string]bool{d.name: d.kind == "fragment"}
+	var walk func(*definition) error
+	walk = func(def *definition) error {
+		for _, name := range def.spreads {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			frag, ok := visible[name]
+			if !ok {
+				if other, ok := all[name]; ok {
+					return errors.Errorf("graphql: %s: %s %q uses fragment %q from %s, which is not imported", d.file, d.kind, d.name, name, other.file)
+				}
+				return errors.Errorf("graphql: %s: %s %q uses undefined fragment %q", d.file, d.kind, d.name, name)
+			}
+			used = append(used, frag)
+			if err := walk(frag); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(d); err != nil {
+		return nil, err
+	}
+	return used, nil
+}
+
+// parseDocument splits a document into its definitions and returns the
+// paths of its #import comments.
+func parseDocument(q string) (defs []*definition, imports []string, err error) {
+	p := &parser{lexer: lexer{q: q, keepComments: true}}
+	doc, err := parseWith(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, def := range doc.definitions {
+		d := &definition{kind: def.kind, name: def.name, text: q[def.start:def.end]}
+		spreads(def.selections, func(name string) {
+			d.spreads = append(d.spreads, name)
+		})
+		defs = append(defs, d)
+	}
+	for _, c := range p.comments {
+		if !strings.HasPrefix(c.text, "#import") || inDefinition(doc, c.start) {
+			continue
+		}
+		imp := strings.TrimSpace(c.text[len("#import"):])
+		if len(imp) < 2 || (imp[0] != '"' && imp[0] != '\'') || imp[len(imp)-1] != imp[0] {
+			return nil, nil, errors.Errorf("invalid import %q", c.text)
+		}
+		imports = append(imports, imp[1:len(imp)-1])
+	}
+	return defs, imports, nil
+}
+
+// inDefinition reports whether offset is inside a definition of doc.
+func inDefinition(doc *astDocument, offset int) bool {
+	for _, def := range doc.definitions {
+		if offset >= def.start && offset < def.end {
+			return true
+		}
+	}
+	return false
+}
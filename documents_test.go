@@ -0,0 +1,127 @@
+package graphqlc
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/matryer/is"
+)
+
+func TestLoadDocuments(t *testing.T) {
+	is := is.New(t)
+	fsys := fstest.MapFS{
+		"graphql/fragments/user.graphql": {Data: []byte(`
+fragment UserFields on User {
+  id
+  name
+  ...AvatarFields
+}
+
+fragment AvatarFields on User {
+  avatar(size: 64) { url }
+}
+
+fragment Unused on User { email }
+`)},
+		"graphql/users.graphql": {Data: []byte(`#import "./fragments/user.graphql"
+
+# the signed in user
+query GetUser($id: Int!) @cached {
+  user(id: $id) {
+    ...UserFields
+    ... on Admin { role }
+    friends { ...UserFields }
+  }
+}
+
+mutation RenameUser($id: Int!, $name: String = "{not a brace") {
+  update_user(id: $id, name: $name) { ...AvatarFields }
+}
+`)},
+	}
+	docs, err := LoadDocuments(fsys, "graphql/*.graphql")
+	is.NoErr(err)
+	is.Equal(docs.Operations(), []string{"GetUser", "RenameUser"})
+
+	q, ok := docs.Query("GetUser")
+	is.True(ok)
+	is.Equal(NormalizeQuery(q), NormalizeQuery(`
+query GetUser($id: Int!) @cached {
+  user(id: $id) { ...UserFields ... on Admin { role } friends { ...UserFields } }
+}
+fragment UserFields on User { id name ...AvatarFields }
+fragment AvatarFields on User { avatar(size: 64) { url } }`))
+
+	req, err := docs.Request("RenameUser")
+	is.NoErr(err)
+	typ, name := req.Operation()
+	is.Equal(typ, OperationMutation)
+	is.Equal(name, "RenameUser")
+	is.Equal(NormalizeQuery(req.Query()), NormalizeQuery(`
+mutation RenameUser($id: Int!, $name: String = "{not a brace") {
+  update_user(id: $id, name: $name) { ...AvatarFields }
+}
+fragment AvatarFields on User { avatar(size: 64) { url } }`))
+
+	_, err = docs.Request("Nope")
+	is.Equal(err.Error(), `graphql: no operation named "Nope"`)
+
+	// with no patterns every .graphql file is loaded
+	docs, err = LoadDocuments(fsys)
+	is.NoErr(err)
+	is.Equal(docs.Operations(), []string{"GetUser", "RenameUser"})
+}
+
+func TestLoadDocumentsErrors(t *testing.T) {
+	is := is.New(t)
+	for _, tt := range []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			files: map[string]string{"a.graphql": `query A { ...Missing }`},
+			err:   `graphql: a.graphql: query "A" uses undefined fragment "Missing"`,
+		},
+		{
+			files: map[string]string{
+				"a.graphql": `query A { ...F }`,
+				"f.graphql": `fragment F on T { x }`,
+			},
+			err: `graphql: a.graphql: query "A" uses fragment "F" from f.graphql, which is not imported`,
+		},
+		{
+			files: map[string]string{
+				"a.graphql": "#import \"f.graphql\"\nfragment F on T { y }",
+				"f.graphql": `fragment F on T { x }`,
+			},
+			err: `graphql: fragment "F" is defined in both a.graphql and f.graphql`,
+		},
+		{
+			files: map[string]string{
+				"a.graphql": `query A { x }`,
+				"b.graphql": `query A { y }`,
+			},
+			err: `graphql: query "A" is defined in both a.graphql and b.graphql`,
+		},
+		{
+			files: map[string]string{"a.graphql": `{ x }`},
+			err:   `graphql: a.graphql: anonymous query, operations must be named`,
+		},
+		{
+			files: map[string]string{"a.graphql": `#import "./missing.graphql"` + "\nquery A { x }"},
+			err:   `a.graphql: importing "./missing.graphql": open missing.graphql: file does not exist`,
+		},
+		{
+			files: map[string]string{"a.graphql": `query A { x `},
+			err:   `graphql: a.graphql: syntax error at offset 12: expected "}", got the end of the document`,
+		},
+	} {
+		fsys := fstest.MapFS{}
+		for name, data := range tt.files {
+			fsys[name] = &fstest.MapFile{Data: []byte(data)}
+		}
+		_, err := LoadDocuments(fsys)
+		is.True(err != nil)
+		is.Equal(err.Error(), tt.err)
+	}
+}
@@ -0,0 +1,303 @@
+package graphqlc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Balancing selects which healthy endpoint serves a request.
+type Balancing int
+
+const (
+	// RoundRobin cycles through the healthy endpoints.
+	RoundRobin Balancing = iota
+	// LeastLatency picks the healthy endpoint with the lowest average
+	// latency.
+	LeastLatency
+)
+
+// Endpoints configures a set of GraphQL endpoints, see WithEndpoints.
+type Endpoints struct {
+	URLs      []string
+	Balancing Balancing
+	// FailureThreshold is the number of consecutive failures after which an
+	// endpoint is ejected. Defaults to 3.
+	FailureThreshold int
+	// ProbeInterval is how often an ejected endpoint is probed to see if it
+	// has recovered. Defaults to 10 seconds.
+	ProbeInterval time.Duration
+	// ProbeQuery is sent to ejected endpoints. Any response without a 5xx
+	// status brings the endpoint back. Defaults to "{ __typename }".
+	ProbeQuery string
+}
+
+// WithEndpoints spreads requests over several replicas of a GraphQL server
+// instead of Client.Endpoint. Endpoints that fail repeatedly are ejected
+// until a health probe succeeds. A query that fails with a network error or
+// 5xx is retried on the next healthy endpoint; a mutation only fails over
+// when it could not be sent at all. Subscriptions connect to a healthy
+// endpoint. If a circuit breaker is configured, each endpoint gets its own.
+func WithEndpoints(e Endpoints) ClientOption {
+	return func(c *Client) {
+		if e.FailureThreshold <= 0 {
+			e.FailureThreshold = 3
+		}
+		if e.ProbeInterval <= 0 {
+			e.ProbeInterval = 10 * time.Second
+		}
+		if e.ProbeQuery == "" {
+			e.ProbeQuery = "{ __typename }"
+		}
+		p := &endpointPool{cfg: e}
+		for _, u := range e.URLs {
+			p.endpoints = append(p.endpoints, &endpoint{url: u})
+		}
+		c.endpoints = p
+		if len(e.URLs) > 0 {
+			c.Endpoint = e.URLs[0]
+		}
+	}
+}
+
+// endpointPool is the set of endpoints configured with WithEndpoints.
+type endpointPool struct {
+	cfg       Endpoints
+	endpoints []*endpoint
+	next      uint32
+}
+
+// endpoint tracks the health of one endpoint.
+type endpoint struct {
+	url string
+
+	breakerOnce sync.Once
+	breaker     *breaker
+
+	mu        sync.Mutex
+	failures  int
+	ejected   bool
+	nextProbe time.Time
+	latency   time.Duration // moving average
+}
+
+func (ep *endpoint) healthy() bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return !ep.ejected
+}
+
+func (ep *endpoint) avgLatency() time.Duration {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.latency
+}
+
+// pick selects an endpoint not in tried, preferring healthy ones. It returns
+// nil once every endpoint has been tried.
+func (p *endpointPool) pick(c *Client, tried map[*endpoint]bool) *endpoint {
+	p.probe(c)
+	var healthy, rest []*endpoint
+	for _, ep := range p.endpoints {
+		if tried[ep] {
+			continue
+		}
+		if ep.healthy() {
+			healthy = append(healthy, ep)
+		} else {
+			rest = append(rest, ep)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		// everything is down: try the ejected endpoints anyway
+		candidates = rest
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if p.cfg.Balancing == LeastLatency {
+		best := candidates[0]
+		for _, ep := range candidates[1:] {
+			if ep.avgLatency() < best.avgLatency() {
+				best = ep
+			}
+		}
+		return best
+	}
+	n := atomic.AddUint32(&p.next, 1) - 1
+	return candidates[int(n%uint32(len(candidates)))]
+}
+
+// report records the outcome of a request to ep.
+func (p *endpointPool) report(c *Client, ep *endpoint, latency time.Duration, failed bool) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if !failed {
+		ep.failures = 0
+		if ep.latency == 0 {
+			ep.latency = latency
+		} else {
+			ep.latency = (ep.latency*4 + latency) / 5
+		}
+		return
+	}
+	ep.failures++
+	if !ep.ejected && ep.failures >= p.cfg.FailureThreshold {
+		ep.ejected = true
+		ep.nextProbe = time.Now().Add(p.cfg.ProbeInterval)
+		c.log(LevelWarn, "endpoint ejected", Field{"endpoint", ep.url}, Field{"failures", ep.failures})
+	}
+}
+
+// probe starts a health probe for every ejected endpoint that is due one.
+func (p *endpointPool) probe(c *Client) {
+	now := time.Now()
+	for _, ep := range p.endpoints {
+		ep.mu.Lock()
+		due := ep.ejected && !now.Before(ep.nextProbe)
+		if due {
+			ep.nextProbe = now.Add(p.cfg.ProbeInterval)
+		}
+		ep.mu.Unlock()
+		if due {
+			go p.probeEndpoint(c, ep)
+		}
+	}
+}
+
+func (p *endpointPool) probeEndpoint(c *Client, ep *endpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.ProbeInterval)
+	defer cancel()
+	body, err := json.Marshal(map[string]string{"query": p.cfg.ProbeQuery})
+	if err != nil {
+		return
+	}
+	r, err := http.NewRequest(http.MethodPost, ep.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for key, values := range c.Header {
+		r.Header[key] = values
+	}
+	if err := c.authorize(ctx, r.Header); err != nil {
+		return
+	}
+	r = r.WithContext(ctx)
+	if c.signer != nil {
+		if err := c.signer.Sign(r, body); err != nil {
+			return
+		}
+	}
+	res, err := c.HttpClient.Do(r)
+	if err != nil {
+		c.log(LevelDebug, "endpoint probe failed", Field{"endpoint", ep.url}, Field{"error", err})
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		c.log(LevelDebug, "endpoint probe failed", Field{"endpoint", ep.url}, Field{"status", res.StatusCode})
+		return
+	}
+	ep.mu.Lock()
+	ep.ejected = false
+	ep.failures = 0
+	ep.mu.Unlock()
+	c.log(LevelInfo, "endpoint restored", Field{"endpoint", ep.url})
+}
+
+// target is where a single attempt is sent.
+type target struct {
+	url     string
+	breaker *breaker
+	ep      *endpoint // nil unless WithEndpoints is used
+
+	// failed is set by Client.do when the server appeared unhealthy.
+	failed bool
+}
+
+func (c *Client) targetFor(ep *endpoint) *target {
+	if ep == nil {
+		return &target{url: c.Endpoint, breaker: c.breaker}
+	}
+	ep.breakerOnce.Do(func() { ep.breaker = c.newBreaker(ep.url) })
+	return &target{url: ep.url, breaker: ep.breaker, ep: ep}
+}
+
+// reportTarget records the outcome of an attempt against t.
+func (c *Client) reportTarget(t *target, latency time.Duration, failed bool) {
+	t.failed = failed
+	if t.ep != nil {
+		c.endpoints.report(c, t.ep, latency, failed)
+	}
+}
+
+// send sends an encoded request, hedging queries if WithHedging is used.
+func (c *Client) send(ctx context.Context, op *OperationInfo, req *Request, body *payload) (*http.Response, []byte, error) {
+	if c.hedging != nil && op.Type == OperationQuery && len(req.files) == 0 {
+		return c.sendHedged(ctx, op, req, body)
+	}
+	return c.sendEndpoints(ctx, op, req, body)
+}
+
+// sendEndpoints sends an encoded request, failing over to other endpoints if
+// WithEndpoints is used.
+func (c *Client) sendEndpoints(ctx context.Context, op *OperationInfo, req *Request, body *payload) (*http.Response, []byte, error) {
+	if c.endpoints == nil {
+		return c.do(ctx, op, req, c.targetFor(nil), body)
+	}
+	tried := make(map[*endpoint]bool)
+	var res *http.Response
+	var buf []byte
+	err := errors.New("graphql: no endpoints configured")
+	for {
+		ep := c.endpoints.pick(c, tried)
+		if ep == nil {
+			return res, buf, err
+		}
+		tried[ep] = true
+		t := c.targetFor(ep)
+		res, buf, err = c.do(ctx, op, req, t, body)
+		if errors.Cause(err) == ErrCircuitOpen {
+			continue
+		}
+		if !t.failed || ctx.Err() != nil {
+			return res, buf, err
+		}
+		if op.Type == OperationMutation && !isDialError(err) {
+			return res, buf, err
+		}
+		c.log(LevelWarn, "endpoint failed, trying the next one", Field{"endpoint", ep.url}, Field{"error", err})
+	}
+}
+
+// pickEndpoint returns the target for a new subscription.
+func (c *Client) pickEndpoint() *target {
+	if c.endpoints == nil {
+		return c.targetFor(nil)
+	}
+	return c.targetFor(c.endpoints.pick(c, nil))
+}
+
+// isDialError reports whether err happened before anything was sent.
+func isDialError(err error) bool {
+	for err != nil {
+		if op, ok := err.(*net.OpError); ok {
+			return op.Op == "dial"
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// newReplica returns a server that answers with its name, or 503 while down
+// is set.
+func newReplica(name string, delay time.Duration, down *int32, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		time.Sleep(delay)
+		if atomic.LoadInt32(down) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{"name":"`+name+`"}}`)
+	}))
+}
+
+func TestEndpointsRoundRobin(t *testing.T) {
+	is := is.New(t)
+	var down, callsA, callsB int32
+	a := newReplica("a", 0, &down, &callsA)
+	defer a.Close()
+	b := newReplica("b", 0, &down, &callsB)
+	defer b.Close()
+
+	client := NewClient("", WithEndpoints(Endpoints{URLs: []string{a.URL, b.URL}}))
+	for i := 0; i < 4; i++ {
+		is.NoErr(client.RunCtxRet(context.Background(), NewRequest("query {}"), nil))
+	}
+	is.Equal(atomic.LoadInt32(&callsA), int32(2))
+	is.Equal(atomic.LoadInt32(&callsB), int32(2))
+}
+
+func TestEndpointsFailover(t *testing.T) {
+	is := is.New(t)
+	var up, downA, callsA, callsB int32
+	downA = 1
+	a := newReplica("a", 0, &downA, &callsA)
+	defer a.Close()
+	b := newReplica("b", 0, &up, &callsB)
+	defer b.Close()
+
+	client := NewClient("", WithEndpoints(Endpoints{
+		URLs:             []string{a.URL, b.URL},
+		FailureThreshold: 2,
+		ProbeInterval:    50 * time.Millisecond,
+	}))
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		var resp struct{ Name string }
+		is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), &resp))
+		is.Equal(resp.Name, "b")
+	}
+	// a was ejected after two failures and is no longer tried
+	is.Equal(atomic.LoadInt32(&callsA), int32(2))
+	is.Equal(atomic.LoadInt32(&callsB), int32(4))
+
+	// mutations are not retried on another endpoint once sent
+	client.endpoints.endpoints[0].ejected = false
+	client.endpoints.next = 0
+	err := client.RunCtxRet(ctx, NewRequest("mutation { x }"), nil)
+	is.Equal(err.Error(), "graphql: server returned a non-200 status code: 503")
+
+	// a recovers and is brought back by the health probe
+	atomic.StoreInt32(&downA, 0)
+	client.endpoints.endpoints[0].ejected = true
+	client.endpoints.endpoints[0].nextProbe = time.Now()
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	time.Sleep(20 * time.Millisecond)
+	is.True(client.endpoints.endpoints[0].healthy())
+}
+
+func TestEndpointsLeastLatency(t *testing.T) {
+	is := is.New(t)
+	var down, callsSlow, callsFast int32
+	slow := newReplica("slow", 30*time.Millisecond, &down, &callsSlow)
+	defer slow.Close()
+	fast := newReplica("fast", 0, &down, &callsFast)
+	defer fast.Close()
+
+	client := NewClient("", WithEndpoints(Endpoints{
+		URLs:      []string{slow.URL, fast.URL},
+		Balancing: LeastLatency,
+	}))
+	for i := 0; i < 6; i++ {
+		is.NoErr(client.RunCtxRet(context.Background(), NewRequest("query {}"), nil))
+	}
+	// each endpoint is measured once, then the fast one wins
+	is.Equal(atomic.LoadInt32(&callsSlow), int32(1))
+	is.Equal(atomic.LoadInt32(&callsFast), int32(5))
+}
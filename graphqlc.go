@@ -33,8 +33,10 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
 )
 
 // Client is a client for interacting with a GraphQL API.
@@ -53,9 +55,66 @@ type Client struct {
 	//  client.Log = func(s string) { log.Println(s) }
 	Log func(s string)
 
+	// Logger, if set, receives structured log entries.
+	Logger Logger
+
+	// Redaction controls which headers, variables and responses are
+	// hidden from Log and Logger.
+	Redaction Redaction
+
+	// tokens supplies the Authorization header, see WithTokenSource.
+	tokens *tokenCache
+
+	// rateLimits limits outgoing requests, see WithRateLimit.
+	rateLimits *rateLimits
+
+	// breaker fails requests fast while the server is down, see
+	// WithCircuitBreaker.
+	breakerConfig *CircuitBreaker
+	breaker       *breaker
+
+	// endpoints replaces Endpoint, see WithEndpoints.
+	endpoints *endpointPool
+
+	// compression compresses requests and responses, see WithCompression.
+	compression *Compression
+
+	// signer signs every request, see WithSigner.
+	signer Signer
+
+	// dedup shares the round trip of identical queries, see
+	// WithDeduplication.
+	dedup *inflight
+
+	// hedging sends a second request for slow queries, see WithHedging.
+	hedging *hedger
+
+	// queryLimits refuses operations that are too complex, see WithLimits.
+	queryLimits *Limits
+
+	// Hooks, if set, are called during operations to support tracing and
+	// monitoring.
+	Hooks *Hooks
+
+	// Metrics, if set, receives operation counts and latencies.
+	Metrics Metrics
+
+	// MaxReconnects is the number of times a subscription re-dials its
+	// websocket after the connection is lost. Zero disables reconnecting.
+	MaxReconnects int
+
+	// ReconnectWait is how long a subscription waits before re-dialing.
+	// Defaults to one second.
+	ReconnectWait time.Duration
+
+	// DialWebsocket, if set, opens the websocket for subscriptions instead
+	// of websocket.DialConfig.
+	DialWebsocket func(ctx context.Context, config *websocket.Config) (*websocket.Conn, error)
+
 	//Determines the default http request headers for graphql queries.
 	//If your graphql request has headers that contradict these, the
-	//graphql request headers will take precedence.
+	//graphql request headers will take precedence, as will headers
+	//attached to the context with ContextWithHeader.
 	http.Header
 }
 
@@ -63,7 +122,7 @@ type Client struct {
 func NewClient(endpoint string, opts ...ClientOption) *Client {
 	c := &Client{
 		Endpoint: endpoint,
-		Log:      func(s string) {},
+		Log:      noopLog,
 	}
 	c.Header = make(http.Header)
 	c.Header.Set("Accept", "application/json; charset=utf-8")
@@ -74,10 +133,6 @@ func NewClient(endpoint string, opts ...ClientOption) *Client {
 	return c
 }
 
-func (c *Client) logf(format string, args ...interface{}) {
-	c.Log(fmt.Sprintf(format, args...))
-}
-
 func (c *Client) Run(req *Request) error {
     return c.RunCtxRet(context.Background(), req, nil)
 }
@@ -87,7 +142,7 @@ func (c *Client) RunRet(req *Request, resp interface{}) error {
 }
 
 func (c *Client) RunCtx(ctx context.Context, req *Request) error {
-    return c.RunCtxRet(context.Background(), req, nil)
+    return c.RunCtxRet(ctx, req, nil)
 }
 
 // Run executes the query and unmarshals the response from the data field into
@@ -98,73 +153,182 @@ func (c *Client) RunCtx(ctx context.Context, req *Request) error {
 // If the request fails or the server returns an error, the first error
 // encountered will be returned.
 func (c *Client) RunCtxRet(ctx context.Context, req *Request, resp interface{}) error {
+	return c.run(ctx, req, resp)
+}
+
+// run runs an operation, filling in the Response of ctx if any.
+func (c *Client) run(ctx context.Context, req *Request, resp interface{}) (err error) {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
 	}
-	if len(req.q) > len("subscription") && req.q[0:len("subscription")] == "subscription" {
-        return errors.New("queries of type \"subscription\" should be sent using client.Subscribe()")
+	op := newOperationInfo(req)
+	if op.Type == OperationSubscription {
+		return errors.New("queries of type \"subscription\" should be sent using client.Subscribe()")
 	}
+	if err := c.checkLimits(req); err != nil {
+		return err
+	}
+	ctx = c.startOperation(ctx, op)
+	defer func() { c.endOperation(ctx, op, err) }()
 	var requestBody bytes.Buffer
 	var contentType string
 	if len(req.files) > 0 {
 		if err := encodeRequestBody(&requestBody, &contentType, req, true); err != nil {
 			return err
 		}
-		c.logf(">> files: %d", len(req.files))
 	} else {
 		if err := encodeRequestBody(&requestBody, &contentType, req, false); err != nil {
 			return err
 		}
 
 	}
-	c.logf(">> variables: %v", req.vars)
-	c.logf(">> query: %s", req.q)
-	gr := &graphResponse{
-		Data: resp,
+	body := &payload{data: requestBody.Bytes(), contentType: contentType}
+	if err := c.compress(body); err != nil {
+		return err
+	}
+	for retried := false; ; retried = true {
+		res, buf, err := c.sendShared(ctx, op, req, body)
+		if err != nil {
+			return err
+		}
+		var raw rawResponse
+		decodeErr := json.Unmarshal(buf, &raw)
+		var gr graphResponse
+		if decodeErr == nil {
+			decodeErr = raw.decode(&gr, resp)
+		}
+		if !retried && c.hasTokenSource() && isAuthFailure(res.StatusCode, gr.Errors) {
+			c.log(LevelInfo, "authentication failed, refreshing token", Field{"status", res.StatusCode})
+			c.tokens.invalidate()
+			continue
+		}
+		if r := responseFrom(ctx); r != nil {
+			r.Data, r.Errors, r.Extensions = raw.Data, raw.Errors, raw.Extensions
+		}
+		if decodeErr != nil {
+			if res.StatusCode != http.StatusOK {
+				return &StatusError{StatusCode: res.StatusCode}
+			}
+			return errors.Wrap(decodeErr, "decoding response")
+		}
+		if len(gr.Errors) > 0 {
+			// return first error
+			err := gr.Errors[0]
+			err.StatusCode = res.StatusCode
+			return err
+		}
+		return nil
 	}
-	r, err := http.NewRequest(http.MethodPost, c.Endpoint, &requestBody)
+}
+
+// do makes a single HTTP round trip for an operation to t and returns the
+// response along with its body.
+func (c *Client) do(ctx context.Context, op *OperationInfo, req *Request, t *target, body *payload) (*http.Response, []byte, error) {
+	r, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body.data))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	r.Close = c.CloseReq
-	r.Header.Set("Content-Type", contentType)
-	for key, values := range c.Header {
-		r.Header.Set(key, values[0])
-		for _, value := range values[1:] {
-			r.Header.Add(key, value)
+	r.Header.Set("Content-Type", body.contentType)
+	if body.contentEncoding != "" {
+		r.Header.Set("Content-Encoding", body.contentEncoding)
+	}
+	if c.compression != nil {
+		r.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	setHeaders(r.Header, c.Header)
+	if err := c.authorize(ctx, r.Header); err != nil {
+		return nil, nil, err
+	}
+	setHeaders(r.Header, HeaderFromContext(ctx))
+	setHeaders(r.Header, req.Header)
+	injectTraceContext(ctx, r.Header)
+	var timings func() Timings
+	if res := responseFrom(ctx); res != nil {
+		*res = Response{}
+		ctx, timings = traceTimings(ctx)
+	}
+	r = r.WithContext(ctx)
+	if c.logEnabled() {
+		c.debug("graphql request",
+			Field{"operation", op.Name},
+			Field{"query", req.q},
+			Field{"variables", c.redactVariables(req.vars)},
+			Field{"files", len(req.files)},
+			Field{"headers", c.redactHeader(r.Header)})
+	}
+	var generation uint64
+	if t.breaker != nil {
+		if generation, err = t.breaker.allow(); err != nil {
+			return nil, nil, err
 		}
 	}
-	for key, values := range req.Header {
-		r.Header.Set(key, values[0])
-		for _, value := range values[1:] {
-			r.Header.Add(key, value)
+	release, err := c.acquire(ctx, op)
+	if err != nil {
+		if t.breaker != nil {
+			t.breaker.cancel(generation)
 		}
+		return nil, nil, err
 	}
-	c.logf(">> headers: %v", r.Header)
-	r = r.WithContext(ctx)
+	defer release()
+	if c.signer != nil {
+		// sign last, so that signatures with a timestamp are not stale
+		// after waiting for the rate limiter
+		if err := c.signer.Sign(r, body.data); err != nil {
+			if t.breaker != nil {
+				t.breaker.cancel(generation)
+			}
+			return nil, nil, errors.Wrap(err, "signing request")
+		}
+	}
+	start := time.Now()
 	res, err := c.HttpClient.Do(r)
+	if err != nil && ctx.Err() == context.Canceled {
+		// the caller gave up, or another hedged attempt won: the time
+		// spent says nothing about the server
+		if t.breaker != nil {
+			t.breaker.cancel(generation)
+		}
+		c.httpAttempt(ctx, op, r, res, start, err)
+		return nil, nil, err
+	}
+	failed := isBreakerFailure(ctx, res, err)
+	if t.breaker != nil {
+		t.breaker.record(generation, failed)
+	}
+	c.reportTarget(t, time.Since(start), failed)
+	c.httpAttempt(ctx, op, r, res, start, err)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	defer res.Body.Close()
 	var buf bytes.Buffer
 	if _, err := io.Copy(&buf, res.Body); err != nil {
-		return errors.Wrap(err, "reading body")
+		return nil, nil, errors.Wrap(err, "reading body")
 	}
-	c.logf("<< %s", buf.String())
-	if err := json.NewDecoder(&buf).Decode(&gr); err != nil {
-		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf("graphql: server returned a non-200 status code: %v", res.StatusCode)
-		}
-		return errors.Wrap(err, "decoding response")
+	data, err := c.decompress(res, buf.Bytes())
+	if err != nil {
+		return nil, nil, err
 	}
-	if len(gr.Errors) > 0 {
-		// return first error
-		return gr.Errors[0]
+	if timings != nil {
+		r := responseFrom(ctx)
+		r.StatusCode, r.Header, r.Timings = res.StatusCode, res.Header, timings()
 	}
-	return nil
+	if c.logEnabled() {
+		c.debug("graphql response",
+			Field{"status", res.StatusCode},
+			Field{"body", c.redactResponse(string(data))})
+	}
+	return res, data, nil
+}
+
+// payload is an encoded request body.
+type payload struct {
+	data            []byte
+	contentType     string
+	contentEncoding string
 }
 
 func encodeRequestBody(requestBody *bytes.Buffer, contentType *string, req *Request, multiPartForm bool) error {
@@ -216,17 +380,66 @@ func encodeRequestBody(requestBody *bytes.Buffer, contentType *string, req *Requ
 // modify the behaviour of the Client.
 type ClientOption func(*Client)
 
-type graphErr struct {
-	Message string
+// Error is an error from the errors of a GraphQL response. RunCtxRet returns
+// the first one.
+type Error struct {
+	Message    string
+	Path       []interface{}
+	Extensions map[string]interface{}
+	// StatusCode is the HTTP status of the response.
+	StatusCode int `json:"-"`
 }
 
-func (e graphErr) Error() string {
+func (e Error) Error() string {
 	return "graphql: " + e.Message
 }
 
+// Code returns extensions.code, if it is a string.
+func (e Error) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// StatusError is returned when the server answers with a non-200 status and
+// no GraphQL response.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("graphql: server returned a non-200 status code: %v", e.StatusCode)
+}
+
 type graphResponse struct {
 	Data   interface{}
-	Errors []graphErr
+	Errors []Error
+}
+
+// rawResponse is a response body with its members left undecoded.
+type rawResponse struct {
+	Data       json.RawMessage
+	Errors     json.RawMessage
+	Extensions json.RawMessage
+}
+
+// decode decodes the errors into gr and the data into resp, if not nil.
+func (raw *rawResponse) decode(gr *graphResponse, resp interface{}) error {
+	if raw.Data != nil && resp != nil {
+		var err error
+		if u, ok := resp.(json.Unmarshaler); ok {
+			// such as Fields, which is not a pointer
+			err = u.UnmarshalJSON(raw.Data)
+		} else {
+			err = json.Unmarshal(raw.Data, resp)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if raw.Errors != nil {
+		return json.Unmarshal(raw.Errors, &gr.Errors)
+	}
+	return nil
 }
 
 // Request is a GraphQL request.
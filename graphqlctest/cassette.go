@@ -0,0 +1,565 @@
+package graphqlctest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/leonardacademy/graphqlc"
+	"golang.org/x/net/websocket"
+)
+
+// Mode selects whether a Recorder talks to the real server.
+type Mode int
+
+const (
+	// Replay answers requests from the cassette without any network
+	// access.
+	Replay Mode = iota
+	// Record forwards requests to the real server and saves the exchanges
+	// to the cassette when the test ends.
+	Record
+)
+
+// Recorder records GraphQL exchanges, including subscription message
+// streams, to a cassette file and replays them later. Plug it into a
+// Client with WithRecorder:
+//
+//  rec := graphqlctest.NewRecorder(t, "testdata/users.json", graphqlctest.Replay)
+//  client := graphqlc.NewClient("https://example.com/graphql", graphqlctest.WithRecorder(rec))
+//
+// Requests are matched on their normalized query and variables.
+type Recorder struct {
+	// IgnoreVariables lists variables that are ignored when matching
+	// requests, such as timestamps or random ids. Paths are dotted, with *
+	// matching any key or list index, e.g. "input.createdAt" or
+	// "items.*.id".
+	IgnoreVariables []string
+
+	// ScrubHeaders lists the headers whose values are replaced before they
+	// are saved, including headers sent in a connection_init payload.
+	// Defaults to graphqlc.DefaultRedactedHeaders.
+	ScrubHeaders []string
+
+	// Transport sends recorded requests. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	t    TestingT
+	path string
+	mode Mode
+
+	mu       sync.Mutex
+	cassette cassette
+	relays   sync.WaitGroup
+}
+
+type cassette struct {
+	Interactions  []*interaction  `json:"interactions"`
+	Subscriptions []*subscription `json:"subscriptions,omitempty"`
+}
+
+type interaction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+	used     bool
+}
+
+type cassetteRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Header        http.Header            `json:"header,omitempty"`
+}
+
+type cassetteResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+	// Binary is set if Body is base64 encoded, for bodies that are
+	// compressed or not valid UTF-8.
+	Binary bool `json:"binary,omitempty"`
+}
+
+// newCassetteResponse returns the recording of res, read as body, with the
+// already scrubbed header.
+func newCassetteResponse(res *http.Response, body []byte, header http.Header) cassetteResponse {
+	cr := cassetteResponse{Status: res.StatusCode, Header: header}
+	if res.Header.Get("Content-Encoding") != "" || !utf8.Valid(body) {
+		cr.Body, cr.Binary = base64.StdEncoding.EncodeToString(body), true
+	} else {
+		cr.Body = string(body)
+	}
+	return cr
+}
+
+// body returns the recorded response body.
+func (cr cassetteResponse) body() ([]byte, error) {
+	if cr.Binary {
+		return base64.StdEncoding.DecodeString(cr.Body)
+	}
+	return []byte(cr.Body), nil
+}
+
+type subscription struct {
+	Header   http.Header       `json:"header,omitempty"`
+	Messages []cassetteMessage `json:"messages"`
+	// ServerClosedAt is the number of messages exchanged before the server
+	// ended the connection, if it did.
+	ServerClosedAt *int `json:"serverClosedAt,omitempty"`
+	used           bool
+}
+
+// serverClosed reports whether the server had closed the connection by
+// message i.
+func (s *subscription) serverClosed(i int) bool {
+	return s.ServerClosedAt != nil && i >= *s.ServerClosedAt
+}
+
+type cassetteMessage struct {
+	// Sent is set for messages sent by the client.
+	Sent bool `json:"sent,omitempty"`
+	Message
+}
+
+// NewRecorder returns a Recorder for the cassette at path. In Replay mode
+// the cassette is loaded straight away; in Record mode it is written when
+// the test ends.
+func NewRecorder(t TestingT, path string, mode Mode) *Recorder {
+	r := &Recorder{t: t, path: path, mode: mode}
+	if mode == Replay {
+		b, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(b, &r.cassette)
+		}
+		if err != nil {
+			t.Errorf("graphqlctest: loading cassette: %v", err)
+		}
+		return r
+	}
+	t.Cleanup(func() {
+		if err := r.Save(); err != nil {
+			t.Errorf("graphqlctest: saving cassette: %v", err)
+		}
+	})
+	return r
+}
+
+// WithRecorder routes a Client's requests and subscriptions through r.
+func WithRecorder(r *Recorder) graphqlc.ClientOption {
+	return func(c *graphqlc.Client) {
+		c.HttpClient = &http.Client{Transport: r}
+		c.DialWebsocket = r.DialWebsocket
+	}
+}
+
+// Save writes the recorded exchanges to the cassette file, once the
+// subscriptions being recorded have ended.
+func (r *Recorder) Save() error {
+	r.relays.Wait()
+	r.mu.Lock()
+	b, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, append(b, '\n'), 0644)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	parse := req.Clone(req.Context())
+	parse.Body = ioutil.NopCloser(bytes.NewReader(body))
+	rec, err := ParseRequest(parse)
+	if err != nil {
+		return nil, fmt.Errorf("graphqlctest: parsing request: %v", err)
+	}
+	if r.mode == Replay {
+		return r.replay(req, rec)
+	}
+
+	send := req.Clone(req.Context())
+	send.Body = ioutil.NopCloser(bytes.NewReader(body))
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(send)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &interaction{
+		Request: cassetteRequest{
+			Query:         rec.Query,
+			OperationName: rec.OperationName,
+			Variables:     rec.Variables,
+			Header:        r.scrub(rec.Header),
+		},
+		Response: newCassetteResponse(res, resBody, r.scrub(res.Header)),
+	})
+	r.mu.Unlock()
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+	return res, nil
+}
+
+// replay answers req with the first unused interaction that matches it, or
+// the last matching one if they have all been used.
+func (r *Recorder) replay(req *http.Request, rec *RecordedRequest) (*http.Response, error) {
+	key := r.key(rec.Query, rec.Variables)
+	r.mu.Lock()
+	var match *interaction
+	for _, in := range r.cassette.Interactions {
+		if r.key(in.Request.Query, in.Request.Variables) != key {
+			continue
+		}
+		match = in
+		if !in.used {
+			break
+		}
+	}
+	if match != nil {
+		match.used = true
+	}
+	r.mu.Unlock()
+	if match == nil {
+		return nil, fmt.Errorf("graphqlctest: no recorded interaction for %s %q", rec.OperationType, rec.OperationName)
+	}
+	body, err := match.Response.body()
+	if err != nil {
+		return nil, fmt.Errorf("graphqlctest: decoding recorded response: %v", err)
+	}
+	header := match.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(match.Response.Status) + " " + http.StatusText(match.Response.Status),
+		StatusCode:    match.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// DialWebsocket opens a subscription websocket, see
+// graphqlc.Client.DialWebsocket. In Record mode the real server is dialed
+// and the messages passing through are recorded; in Replay mode a recorded
+// message stream is played back.
+func (r *Recorder) DialWebsocket(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+	if r.mode == Replay {
+		return pipeWebsocket(ctx, config, r.replayWebsocket)
+	}
+	upstream, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscription{Header: r.scrub(config.Header)}
+	r.relays.Add(1)
+	ws, err := pipeWebsocket(ctx, config, func(ws *websocket.Conn) {
+		defer r.relays.Done()
+		r.relay(ws, upstream, sub)
+	})
+	if err != nil {
+		upstream.Close()
+		r.relays.Done()
+	}
+	return ws, err
+}
+
+// relay passes messages between the client and the real server, recording
+// them in sub.
+func (r *Recorder) relay(client, upstream *websocket.Conn, sub *subscription) {
+	var mu sync.Mutex
+	clientClosed := false
+	add := func(sent bool, raw string) {
+		var m Message
+		if err := json.Unmarshal([]byte(raw), &m); err != nil {
+			return
+		}
+		if m.Type == "connection_init" {
+			m.Payload = r.scrubInit(m.Payload)
+		}
+		mu.Lock()
+		sub.Messages = append(sub.Messages, cassetteMessage{Sent: sent, Message: m})
+		mu.Unlock()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var raw string
+			if err := websocket.Message.Receive(upstream, &raw); err != nil {
+				mu.Lock()
+				if !clientClosed {
+					n := len(sub.Messages)
+					sub.ServerClosedAt = &n
+				}
+				mu.Unlock()
+				client.Close()
+				return
+			}
+			add(false, raw)
+			websocket.Message.Send(client, raw)
+		}
+	}()
+	for {
+		var raw string
+		if err := websocket.Message.Receive(client, &raw); err != nil {
+			mu.Lock()
+			clientClosed = true
+			mu.Unlock()
+			upstream.Close()
+			break
+		}
+		add(true, raw)
+		websocket.Message.Send(upstream, raw)
+	}
+	<-done
+	r.mu.Lock()
+	r.cassette.Subscriptions = append(r.cassette.Subscriptions, sub)
+	r.mu.Unlock()
+}
+
+// replayWebsocket plays back a recorded subscription. The messages sent
+// before the subscription starts come from the next unused recording; once
+// the client's start message arrives, the recording with a matching query
+// and variables is played.
+func (r *Recorder) replayWebsocket(ws *websocket.Conn) {
+	defer ws.Close()
+	var init Message
+	if err := websocket.JSON.Receive(ws, &init); err != nil {
+		return
+	}
+	r.mu.Lock()
+	var sub *subscription
+	for _, s := range r.cassette.Subscriptions {
+		if !s.used {
+			sub = s
+			break
+		}
+	}
+	if sub != nil && startIndex(sub) < 0 {
+		sub.used = true
+	}
+	r.mu.Unlock()
+	if sub == nil {
+		websocket.JSON.Send(ws, Message{Type: "connection_error", Payload: json.RawMessage(`{"message":"graphqlctest: no recorded subscription left"}`)})
+		return
+	}
+	// play the server's answer to connection_init
+	i := 1
+	for ; i < len(sub.Messages) && !sub.Messages[i].Sent && !sub.serverClosed(i); i++ {
+		websocket.JSON.Send(ws, sub.Messages[i].Message)
+	}
+	if sub.serverClosed(i) {
+		return
+	}
+	for {
+		var m Message
+		if err := websocket.JSON.Receive(ws, &m); err != nil {
+			return
+		}
+		if m.Type != "start" {
+			continue
+		}
+		played := r.matchSubscription(m.Payload)
+		if played == nil {
+			websocket.JSON.Send(ws, Message{Type: "error", ID: m.ID, Payload: json.RawMessage(`{"message":"graphqlctest: no recorded subscription matches"}`)})
+			websocket.JSON.Send(ws, Message{Type: "complete", ID: m.ID})
+			continue
+		}
+		start := startIndex(played)
+		recordedID := played.Messages[start].ID
+		i := start + 1
+		for ; i < len(played.Messages) && !played.serverClosed(i); i++ {
+			sm := played.Messages[i]
+			if sm.Sent {
+				if sm.Type == "stop" {
+					break
+				}
+				continue
+			}
+			msg := sm.Message
+			if msg.ID == recordedID {
+				msg.ID = m.ID
+			}
+			websocket.JSON.Send(ws, msg)
+		}
+		if played.serverClosed(i) {
+			return
+		}
+	}
+}
+
+// matchSubscription returns the first unused recording whose start message
+// matches payload and marks it used.
+func (r *Recorder) matchSubscription(payload json.RawMessage) *subscription {
+	var start struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	json.Unmarshal(payload, &start)
+	key := r.key(start.Query, start.Variables)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.cassette.Subscriptions {
+		i := startIndex(s)
+		if s.used || i < 0 {
+			continue
+		}
+		var rec struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.Unmarshal(s.Messages[i].Payload, &rec)
+		if r.key(rec.Query, rec.Variables) == key {
+			s.used = true
+			return s
+		}
+	}
+	return nil
+}
+
+// startIndex returns the index of the client's start message in s, or -1.
+func startIndex(s *subscription) int {
+	for i, m := range s.Messages {
+		if m.Sent && m.Type == "start" {
+			return i
+		}
+	}
+	return -1
+}
+
+// key identifies a request for matching: its normalized query and its
+// variables, with ignored variables blanked out.
+func (r *Recorder) key(query string, vars map[string]interface{}) string {
+	var v interface{} = map[string]interface{}{}
+	if len(vars) > 0 {
+		if b, err := json.Marshal(vars); err == nil {
+			json.Unmarshal(b, &v)
+		}
+	}
+	for _, path := range r.IgnoreVariables {
+		v = ignorePath(v, strings.Split(path, "."))
+	}
+	b, _ := json.Marshal(v)
+	return graphqlc.NormalizeQuery(query) + "\n" + string(b)
+}
+
+func ignorePath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return nil
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if path[0] == "*" || path[0] == key {
+				v[key] = ignorePath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				v[i] = ignorePath(child, path[1:])
+			}
+		}
+	}
+	return v
+}
+
+func (r *Recorder) scrubbed(key string) bool {
+	headers := r.ScrubHeaders
+	if headers == nil {
+		headers = graphqlc.DefaultRedactedHeaders
+	}
+	for _, h := range headers {
+		if strings.EqualFold(h, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrub returns a copy of h with secret values replaced.
+func (r *Recorder) scrub(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	ret := make(http.Header, len(h))
+	for key, values := range h {
+		if r.scrubbed(key) {
+			ret[key] = []string{graphqlc.Redacted}
+			continue
+		}
+		ret[key] = append([]string(nil), values...)
+	}
+	return ret
+}
+
+// scrubInit scrubs the headers in a connection_init payload, whether they
+// are top-level keys or under "headers".
+func (r *Recorder) scrubInit(payload json.RawMessage) json.RawMessage {
+	var p map[string]interface{}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return payload
+	}
+	for key := range p {
+		if r.scrubbed(key) {
+			p[key] = graphqlc.Redacted
+		}
+	}
+	if headers, ok := p["headers"].(map[string]interface{}); ok {
+		for key := range headers {
+			if r.scrubbed(key) {
+				headers[key] = graphqlc.Redacted
+			}
+		}
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return payload
+	}
+	return b
+}
+
+// pipeWebsocket connects a websocket client to handler in memory.
+func pipeWebsocket(ctx context.Context, config *websocket.Config, handler websocket.Handler) (*websocket.Conn, error) {
+	return graphqlc.DialHandler(websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			config.Protocol = []string{"graphql-ws"}
+			return nil
+		},
+		Handler: handler,
+	})(ctx, config)
+}
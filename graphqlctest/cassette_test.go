@@ -0,0 +1,145 @@
+package graphqlctest
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leonardacademy/graphqlc"
+	"github.com/matryer/is"
+)
+
+func TestRecorder(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "testdata", "cassette.json")
+
+	// record
+	t.Run("record", func(t *testing.T) {
+		is := is.New(t)
+		srv := NewServer(t)
+		srv.Expect().
+			OperationName("GetUser").
+			RespondData(map[string]interface{}{"user": map[string]interface{}{"name": "bob"}})
+		srv.Expect().
+			OperationName("GetUser").
+			RespondErrors(Error{Message: "gone"})
+		subs := NewSubscriptionServer(t)
+		subs.Script().Ack().Data(map[string]interface{}{"n": 1}).Data(map[string]interface{}{"n": 2}).Complete()
+
+		rec := NewRecorder(t, path, Record)
+		client := graphqlc.NewClient(srv.URL, WithRecorder(rec))
+		client.Header.Set("Authorization", "Bearer secret")
+		var resp struct{ User struct{ Name string } }
+		req := graphqlc.NewRequest(`query GetUser($id: Int, $now: String) { user(id: $id) { name } }`)
+		req.Var("id", 1)
+		req.Var("now", "2020-01-01")
+		is.NoErr(client.RunCtxRet(context.Background(), req, &resp))
+		is.Equal(resp.User.Name, "bob")
+		is.Equal(client.RunCtxRet(context.Background(), req, nil).Error(), "graphql: gone")
+
+		subClient := graphqlc.NewClient(subs.URL, WithRecorder(rec))
+		events := make(chan graphqlc.SubscriptionEvent)
+		go subClient.Subscribe(context.Background(), graphqlc.NewRequest(`subscription { n }`), events)
+		got := collect(events)
+		is.Equal(len(got), 2)
+		is.Equal(string(got[1].Data), `{"n":2}`)
+	})
+
+	b, err := ioutil.ReadFile(path)
+	is.NoErr(err)
+	is.True(!strings.Contains(string(b), "secret")) // Authorization is scrubbed
+	is.True(strings.Contains(string(b), graphqlc.Redacted))
+
+	// replay, with the servers gone
+	rec := NewRecorder(t, path, Replay)
+	rec.IgnoreVariables = []string{"now"}
+	client := graphqlc.NewClient("http://127.0.0.1:1/graphql", WithRecorder(rec))
+	var resp struct{ User struct{ Name string } }
+	req := graphqlc.NewRequest(`
+		query GetUser($id: Int, $now: String) {
+			user(id: $id) { name }
+		}`)
+	req.Var("id", 1)
+	req.Var("now", "2021-06-30")
+	is.NoErr(client.RunCtxRet(context.Background(), req, &resp))
+	is.Equal(resp.User.Name, "bob")
+	is.Equal(client.RunCtxRet(context.Background(), req, nil).Error(), "graphql: gone")
+
+	req.Var("id", 2)
+	err = client.RunCtxRet(context.Background(), req, nil)
+	is.True(strings.Contains(err.Error(), `no recorded interaction for query "GetUser"`))
+
+	events := make(chan graphqlc.SubscriptionEvent)
+	go client.Subscribe(context.Background(), graphqlc.NewRequest(`subscription{n}`), events)
+	got := collect(events)
+	is.Equal(len(got), 2)
+	is.Equal(string(got[0].Data), `{"n":1}`)
+	is.Equal(string(got[1].Data), `{"n":2}`)
+}
+
+func TestRecorderSubscriptionDisconnect(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	t.Run("record", func(t *testing.T) {
+		is := is.New(t)
+		subs := NewSubscriptionServer(t)
+		subs.Script().Ack().Data(map[string]interface{}{"n": 1}).Disconnect()
+		client := graphqlc.NewClient(subs.URL, WithRecorder(NewRecorder(t, path, Record)))
+		events := make(chan graphqlc.SubscriptionEvent)
+		go client.Subscribe(context.Background(), graphqlc.NewRequest(`subscription { n }`), events)
+		got := collect(events)
+		is.Equal(len(got), 2)
+		is.True(got[1].Err != nil)
+	})
+
+	client := graphqlc.NewClient("http://127.0.0.1:1/graphql", WithRecorder(NewRecorder(t, path, Replay)))
+	events := make(chan graphqlc.SubscriptionEvent)
+	go client.Subscribe(context.Background(), graphqlc.NewRequest(`subscription { n }`), events)
+	got := collect(events)
+	is.Equal(len(got), 2)
+	is.Equal(string(got[0].Data), `{"n":1}`)
+	is.True(got[1].Err != nil)
+}
+
+func TestRecorderScrubInit(t *testing.T) {
+	is := is.New(t)
+	rec := NewRecorder(t, filepath.Join(t.TempDir(), "cassette.json"), Record)
+	payload := rec.scrubInit([]byte(`{"Authorization":"Bearer hunter2","x-hasura-admin-secret":"hunter2","headers":{"authorization":"Bearer hunter2","X-Role":"user"},"role":"user"}`))
+	is.True(!strings.Contains(string(payload), "hunter2")) // top-level and nested headers are scrubbed
+	is.True(strings.Contains(string(payload), `"X-Role":"user"`))
+	is.True(strings.Contains(string(payload), `"role":"user"`))
+}
+
+func TestRecorderCompressed(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("Accept-Encoding"), "gzip, deflate")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, `{"data":{"user":{"name":"bob"}}}`)
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	req := graphqlc.NewRequest(`query GetUser { user { name } }`)
+	rec := NewRecorder(t, path, Record)
+	client := graphqlc.NewClient(srv.URL, WithRecorder(rec), graphqlc.WithCompression(graphqlc.Compression{}))
+	var resp struct{ User struct{ Name string } }
+	is.NoErr(client.RunCtxRet(context.Background(), req, &resp))
+	is.Equal(resp.User.Name, "bob")
+	is.NoErr(rec.Save())
+
+	rec = NewRecorder(t, path, Replay)
+	client = graphqlc.NewClient("http://127.0.0.1:1/graphql", WithRecorder(rec), graphqlc.WithCompression(graphqlc.Compression{}))
+	resp.User.Name = ""
+	is.NoErr(client.RunCtxRet(context.Background(), req, &resp))
+	is.Equal(resp.User.Name, "bob")
+}
@@ -0,0 +1,408 @@
+// Package graphqlctest provides fake GraphQL servers for testing code that
+// uses graphqlc.
+//
+//  srv := graphqlctest.NewServer(t)
+//  srv.Expect().
+//      OperationName("GetUser").
+//      Variable("id", 1).
+//      RespondData(map[string]interface{}{"user": map[string]interface{}{"name": "bob"}})
+//
+//  client := graphqlc.NewClient(srv.URL)
+//  // ... exercise the code under test ...
+//
+// Unmet expectations and unexpected requests fail the test when it ends.
+package graphqlctest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leonardacademy/graphqlc"
+)
+
+// TestingT is the subset of testing.TB used by the fake servers.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Server is a fake GraphQL HTTP server that answers requests according to
+// scripted expectations and records every request it receives.
+type Server struct {
+	*httptest.Server
+	t TestingT
+
+	mu           sync.Mutex
+	expectations []*Expectation
+	requests     []*RecordedRequest
+	unexpected   []*RecordedRequest
+}
+
+// NewServer starts a Server. It is closed, and its expectations checked,
+// when the test ends.
+func NewServer(t TestingT) *Server {
+	s := &Server{t: t}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(func() {
+		s.Close()
+		if err := s.ExpectationsWereMet(); err != nil {
+			t.Errorf("graphqlctest: %v", err)
+		}
+	})
+	return s
+}
+
+// RecordedRequest is a GraphQL request received by a fake server.
+type RecordedRequest struct {
+	Query         string
+	OperationName string
+	OperationType string
+	Variables     map[string]interface{}
+	Header        http.Header
+	// Body is the raw request body, decompressed.
+	Body []byte
+}
+
+// Expect adds an expectation. Requests are answered by the first
+// expectation, in the order they were added, that matches the request and
+// has not been used up.
+func (s *Server) Expect() *Expectation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := &Expectation{times: 1, status: http.StatusOK}
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []*RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*RecordedRequest(nil), s.requests...)
+}
+
+// ExpectationsWereMet returns an error describing any expectation that was
+// not used as many times as required, or any request that matched no
+// expectation.
+func (s *Server) ExpectationsWereMet() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var problems []string
+	for _, e := range s.expectations {
+		if e.times > 0 && e.calls < e.times {
+			problems = append(problems, fmt.Sprintf("expected %s %d time(s), got %d", e, e.times, e.calls))
+		}
+	}
+	for _, r := range s.unexpected {
+		problems = append(problems, fmt.Sprintf("unexpected request %s %q", r.OperationType, r.OperationName))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec, err := ParseRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, response{Errors: []Error{{Message: err.Error()}}})
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, rec)
+	var match *Expectation
+	for _, e := range s.expectations {
+		if (e.times <= 0 || e.calls < e.times) && e.matches(rec) {
+			match = e
+			break
+		}
+	}
+	if match == nil {
+		s.unexpected = append(s.unexpected, rec)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+		writeJSON(w, response{Errors: []Error{{Message: "graphqlctest: no expectation matches " + rec.OperationName}}})
+		return
+	}
+	match.calls++
+	s.mu.Unlock()
+	match.respond(w)
+}
+
+// ParseRequest decodes a GraphQL request sent as JSON or as a multipart
+// form, possibly gzipped.
+func ParseRequest(r *http.Request) (*RecordedRequest, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body, err = ioutil.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	rec := &RecordedRequest{Header: r.Header.Clone(), Body: body}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return nil, err
+		}
+		rec.Query = r.FormValue("query")
+		if v := r.FormValue("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &rec.Variables); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		var payload struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, err
+		}
+		rec.Query = payload.Query
+		rec.OperationName = payload.OperationName
+		rec.Variables = payload.Variables
+	}
+	typ, name := graphqlc.NewRequest(rec.Query).Operation()
+	rec.OperationType = typ
+	if rec.OperationName == "" {
+		rec.OperationName = name
+	}
+	return rec, nil
+}
+
+// Expectation describes the requests a fake server expects and how it
+// answers them. By default an expectation matches any request, is expected
+// exactly once and answers with an empty data object.
+type Expectation struct {
+	operationName *string
+	query         *string
+	variables     map[string]interface{}
+	exactVars     bool
+	matchers      []func(*RecordedRequest) bool
+
+	times  int
+	calls  int
+	delay  time.Duration
+	status int
+	header http.Header
+	body   []byte
+	resp   *response
+}
+
+// Error is a GraphQL error returned by a fake server.
+type Error struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type response struct {
+	Data       interface{}            `json:"data,omitempty"`
+	Errors     []Error                `json:"errors,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// OperationName matches requests for the named operation.
+func (e *Expectation) OperationName(name string) *Expectation {
+	e.operationName = &name
+	return e
+}
+
+// Query matches requests whose query equals q, ignoring formatting.
+func (e *Expectation) Query(q string) *Expectation {
+	n := graphqlc.NormalizeQuery(q)
+	e.query = &n
+	return e
+}
+
+// Variables matches requests whose variables equal vars once both are
+// encoded as JSON.
+func (e *Expectation) Variables(vars map[string]interface{}) *Expectation {
+	e.variables = vars
+	e.exactVars = true
+	return e
+}
+
+// Variable matches requests with the variable key set to value, compared
+// as JSON. Other variables are ignored.
+func (e *Expectation) Variable(key string, value interface{}) *Expectation {
+	if e.variables == nil {
+		e.variables = make(map[string]interface{})
+	}
+	e.variables[key] = value
+	return e
+}
+
+// Match matches requests for which f returns true.
+func (e *Expectation) Match(f func(*RecordedRequest) bool) *Expectation {
+	e.matchers = append(e.matchers, f)
+	return e
+}
+
+// Times sets how many times the expectation must be used. Zero or less
+// means any number of times, including none.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Delay waits for d before answering.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// Header sets a response header.
+func (e *Expectation) Header(key, value string) *Expectation {
+	if e.header == nil {
+		e.header = make(http.Header)
+	}
+	e.header.Set(key, value)
+	return e
+}
+
+// RespondData answers with data, encoded as JSON.
+func (e *Expectation) RespondData(data interface{}) *Expectation {
+	if e.resp == nil {
+		e.resp = &response{}
+	}
+	e.resp.Data = data
+	return e
+}
+
+// RespondErrors answers with GraphQL errors, alongside any data set with
+// RespondData.
+func (e *Expectation) RespondErrors(errs ...Error) *Expectation {
+	if e.resp == nil {
+		e.resp = &response{}
+	}
+	e.resp.Errors = append(e.resp.Errors, errs...)
+	return e
+}
+
+// RespondExtensions sets the extensions of the response.
+func (e *Expectation) RespondExtensions(ext map[string]interface{}) *Expectation {
+	if e.resp == nil {
+		e.resp = &response{}
+	}
+	e.resp.Extensions = ext
+	return e
+}
+
+// RespondStatus answers with an HTTP status code and raw body, to simulate
+// HTTP failures.
+func (e *Expectation) RespondStatus(status int, body string) *Expectation {
+	e.status = status
+	e.body = []byte(body)
+	return e
+}
+
+func (e *Expectation) String() string {
+	var parts []string
+	if e.operationName != nil {
+		parts = append(parts, "operation "+*e.operationName)
+	}
+	if e.query != nil {
+		parts = append(parts, "query "+*e.query)
+	}
+	if len(e.variables) > 0 {
+		b, _ := json.Marshal(e.variables)
+		parts = append(parts, "variables "+string(b))
+	}
+	if len(parts) == 0 {
+		return "any request"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (e *Expectation) matches(r *RecordedRequest) bool {
+	if e.operationName != nil && *e.operationName != r.OperationName {
+		return false
+	}
+	if e.query != nil && *e.query != graphqlc.NormalizeQuery(r.Query) {
+		return false
+	}
+	if e.variables != nil {
+		want, got := normalizeJSON(e.variables), r.Variables
+		if e.exactVars {
+			if len(want) == 0 && len(got) == 0 {
+				// null and {} are the same
+			} else if !reflect.DeepEqual(want, got) {
+				return false
+			}
+		} else {
+			for key, value := range want {
+				if !reflect.DeepEqual(value, got[key]) {
+					return false
+				}
+			}
+		}
+	}
+	for _, m := range e.matchers {
+		if !m(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) respond(w http.ResponseWriter) {
+	if e.delay > 0 {
+		time.Sleep(e.delay)
+	}
+	for key, values := range e.header {
+		w.Header()[key] = values
+	}
+	if e.body != nil {
+		w.WriteHeader(e.status)
+		w.Write(e.body)
+		return
+	}
+	resp := e.resp
+	if resp == nil {
+		resp = &response{Data: map[string]interface{}{}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	writeJSON(w, resp)
+}
+
+// normalizeJSON round trips v through JSON so it compares equal to decoded
+// request variables.
+func normalizeJSON(v map[string]interface{}) map[string]interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var ret map[string]interface{}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return v
+	}
+	return ret
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,103 @@
+package graphqlctest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/leonardacademy/graphqlc"
+	"github.com/matryer/is"
+)
+
+func TestServer(t *testing.T) {
+	is := is.New(t)
+	srv := NewServer(t)
+	srv.Expect().
+		OperationName("GetUser").
+		Variable("id", 1).
+		RespondData(map[string]interface{}{"user": map[string]interface{}{"name": "bob"}})
+	srv.Expect().
+		Query(`mutation DeleteUser($id: Int!) { delete_user(id: $id) { id } }`).
+		Variables(map[string]interface{}{"id": 2}).
+		RespondErrors(Error{Message: "not allowed", Extensions: map[string]interface{}{"code": "permission-error"}})
+	srv.Expect().
+		OperationName("Flaky").
+		RespondStatus(503, "Service Unavailable").
+		Times(2)
+
+	client := graphqlc.NewClient(srv.URL)
+	ctx := context.Background()
+
+	req := graphqlc.NewRequest(`query GetUser($id: Int!) { user(id: $id) { name } }`)
+	req.Var("id", 1)
+	req.Header.Set("X-Request-Id", "abc")
+	var resp struct{ User struct{ Name string } }
+	is.NoErr(client.RunCtxRet(ctx, req, &resp))
+	is.Equal(resp.User.Name, "bob")
+
+	req = graphqlc.NewRequest(`
+		mutation DeleteUser($id: Int!) {
+			delete_user(id: $id) {
+				id
+			}
+		}`)
+	req.Var("id", 2)
+	err := client.RunCtxRet(ctx, req, nil)
+	is.Equal(err.Error(), "graphql: not allowed")
+
+	for i := 0; i < 2; i++ {
+		err = client.RunCtxRet(ctx, graphqlc.NewRequest(`query Flaky { x }`), nil)
+		is.Equal(err.Error(), "graphql: server returned a non-200 status code: 503")
+	}
+
+	requests := srv.Requests()
+	is.Equal(len(requests), 4)
+	is.Equal(requests[0].OperationName, "GetUser")
+	is.Equal(requests[0].OperationType, graphqlc.OperationQuery)
+	is.Equal(requests[0].Variables["id"], float64(1))
+	is.Equal(requests[0].Header.Get("X-Request-Id"), "abc")
+	is.Equal(requests[1].OperationType, graphqlc.OperationMutation)
+	is.NoErr(srv.ExpectationsWereMet())
+}
+
+func TestServerFiles(t *testing.T) {
+	is := is.New(t)
+	srv := NewServer(t)
+	srv.Expect().OperationName("Upload").Variable("name", "a.txt")
+
+	req := graphqlc.NewRequest(`mutation Upload($name: String!) { upload(name: $name) }`)
+	req.Var("name", "a.txt")
+	req.File("file", "a.txt", strings.NewReader("contents"))
+	is.NoErr(graphqlc.NewClient(srv.URL).RunCtxRet(context.Background(), req, nil))
+}
+
+type fakeT struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (t *fakeT) Helper() {}
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+func (t *fakeT) Cleanup(f func()) { t.cleanups = append(t.cleanups, f) }
+
+func TestServerUnmetExpectations(t *testing.T) {
+	is := is.New(t)
+	ft := &fakeT{}
+	srv := NewServer(ft)
+	srv.Expect().OperationName("Never")
+	srv.Expect().OperationName("Twice").Times(2)
+
+	client := graphqlc.NewClient(srv.URL)
+	is.NoErr(client.RunCtxRet(context.Background(), graphqlc.NewRequest(`query Twice { x }`), nil))
+	err := client.RunCtxRet(context.Background(), graphqlc.NewRequest(`query Other { x }`), nil)
+	is.Equal(err.Error(), "graphql: graphqlctest: no expectation matches Other")
+
+	for _, f := range ft.cleanups {
+		f()
+	}
+	is.Equal(len(ft.errors), 1)
+	is.Equal(ft.errors[0], `graphqlctest: expected operation Never 1 time(s), got 0; expected operation Twice 2 time(s), got 1; unexpected request query "Other"`)
+}
@@ -0,0 +1,300 @@
+package graphqlctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// SubscriptionServer is a fake GraphQL server speaking the graphql-ws
+// websocket protocol. Every connection plays a Script; connections beyond
+// the number of scripts replay the last one.
+//
+//  srv := graphqlctest.NewSubscriptionServer(t)
+//  srv.Script().Ack().Data(map[string]interface{}{"n": 1}).Disconnect()
+//  srv.Script().Ack().Data(map[string]interface{}{"n": 2}).Complete()
+type SubscriptionServer struct {
+	*httptest.Server
+	t TestingT
+
+	mu       sync.Mutex
+	changed  chan struct{}
+	scripts  []*Script
+	conns    int
+	messages []Message
+}
+
+// Message is a graphql-ws message received from a client.
+type Message struct {
+	// Conn is the connection the message arrived on, counting from 0.
+	Conn    int             `json:"-"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// NewSubscriptionServer starts a SubscriptionServer. It is closed when the
+// test ends.
+func NewSubscriptionServer(t TestingT) *SubscriptionServer {
+	s := &SubscriptionServer{t: t, changed: make(chan struct{})}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *SubscriptionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			config.Protocol = []string{"graphql-ws"}
+			return nil
+		},
+		Handler: s.serve,
+	}.ServeHTTP(w, r)
+}
+
+// Script adds the script for the next connection.
+func (s *SubscriptionServer) Script() *Script {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc := &Script{}
+	s.scripts = append(s.scripts, sc)
+	return sc
+}
+
+// Messages returns every message received so far.
+func (s *SubscriptionServer) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Connections returns the number of connections accepted so far.
+func (s *SubscriptionServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// Await waits until at least n messages of type typ have been received and
+// returns them. It fails the test if they don't arrive within timeout.
+func (s *SubscriptionServer) Await(typ string, n int, timeout time.Duration) []Message {
+	s.t.Helper()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		var ret []Message
+		for _, m := range s.messages {
+			if m.Type == typ {
+				ret = append(ret, m)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		if len(ret) >= n {
+			return ret
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			s.t.Errorf("graphqlctest: got %d %q message(s) after %v, want %d", len(ret), typ, timeout, n)
+			return ret
+		}
+	}
+}
+
+func (s *SubscriptionServer) record(m Message) {
+	s.mu.Lock()
+	s.messages = append(s.messages, m)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+}
+
+func (s *SubscriptionServer) serve(ws *websocket.Conn) {
+	defer ws.Close()
+	s.mu.Lock()
+	conn := s.conns
+	s.conns++
+	var sc *Script
+	if len(s.scripts) > 0 {
+		sc = s.scripts[len(s.scripts)-1]
+		if conn < len(s.scripts) {
+			sc = s.scripts[conn]
+		}
+	} else {
+		sc = (&Script{}).Ack()
+	}
+	s.mu.Unlock()
+
+	var init Message
+	if err := websocket.JSON.Receive(ws, &init); err != nil {
+		return
+	}
+	init.Conn = conn
+	s.record(init)
+
+	// read the client's messages in the background, handing start
+	// messages to the script
+	starts := make(chan string, 16)
+	closed := make(chan struct{})
+	// finished is closed when the script has run, after which start
+	// messages are only recorded
+	finished := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var m Message
+			if err := websocket.JSON.Receive(ws, &m); err != nil {
+				return
+			}
+			m.Conn = conn
+			s.record(m)
+			if m.Type == "start" {
+				select {
+				case starts <- m.ID:
+				case <-finished:
+				}
+			}
+		}
+	}()
+
+	var id string
+	awaitStart := func() bool {
+		if id != "" {
+			return true
+		}
+		select {
+		case id = <-starts:
+			return true
+		case <-closed:
+			return false
+		}
+	}
+	keepOpen := func() bool {
+		for _, st := range sc.steps {
+			switch st.kind {
+			case stepSend:
+				if st.needsID && !awaitStart() {
+					return false
+				}
+				msg := struct {
+					Type    string      `json:"type"`
+					ID      string      `json:"id,omitempty"`
+					Payload interface{} `json:"payload,omitempty"`
+				}{st.typ, "", st.payload}
+				if st.needsID {
+					msg.ID = id
+				}
+				if err := websocket.JSON.Send(ws, msg); err != nil {
+					return false
+				}
+			case stepWait:
+				select {
+				case <-time.After(st.wait):
+				case <-closed:
+					return false
+				}
+			case stepAwaitStart:
+				if !awaitStart() {
+					return false
+				}
+			case stepDisconnect:
+				return false
+			}
+		}
+		return true
+	}()
+	close(finished)
+	if keepOpen {
+		// keep the connection open until the client goes away
+		<-closed
+	}
+}
+
+// Script is the sequence of messages a SubscriptionServer sends on a
+// connection, after receiving connection_init. Messages tied to a
+// subscription wait for the client's start message.
+type Script struct {
+	steps []step
+}
+
+type stepKind int
+
+const (
+	stepSend stepKind = iota
+	stepWait
+	stepAwaitStart
+	stepDisconnect
+)
+
+type step struct {
+	kind    stepKind
+	typ     string
+	payload interface{}
+	needsID bool
+	wait    time.Duration
+}
+
+func (sc *Script) send(typ string, payload interface{}, needsID bool) *Script {
+	sc.steps = append(sc.steps, step{kind: stepSend, typ: typ, payload: payload, needsID: needsID})
+	return sc
+}
+
+// Ack sends connection_ack.
+func (sc *Script) Ack() *Script {
+	return sc.send("connection_ack", nil, false)
+}
+
+// ConnectionError sends connection_error with payload.
+func (sc *Script) ConnectionError(payload interface{}) *Script {
+	return sc.send("connection_error", payload, false)
+}
+
+// KeepAlive sends ka.
+func (sc *Script) KeepAlive() *Script {
+	return sc.send("ka", nil, false)
+}
+
+// AwaitStart waits for the client to start a subscription.
+func (sc *Script) AwaitStart() *Script {
+	sc.steps = append(sc.steps, step{kind: stepAwaitStart})
+	return sc
+}
+
+// Data sends a data message carrying data.
+func (sc *Script) Data(data interface{}) *Script {
+	return sc.send("data", map[string]interface{}{"data": data}, true)
+}
+
+// DataErrors sends a data message carrying GraphQL errors.
+func (sc *Script) DataErrors(errs ...Error) *Script {
+	return sc.send("data", map[string]interface{}{"data": nil, "errors": errs}, true)
+}
+
+// Error sends an error message with payload.
+func (sc *Script) Error(payload interface{}) *Script {
+	return sc.send("error", payload, true)
+}
+
+// Complete sends complete, ending the subscription.
+func (sc *Script) Complete() *Script {
+	return sc.send("complete", nil, true)
+}
+
+// Wait pauses the script for d.
+func (sc *Script) Wait(d time.Duration) *Script {
+	sc.steps = append(sc.steps, step{kind: stepWait, wait: d})
+	return sc
+}
+
+// Disconnect closes the connection abruptly.
+func (sc *Script) Disconnect() *Script {
+	sc.steps = append(sc.steps, step{kind: stepDisconnect})
+	return sc
+}
@@ -0,0 +1,162 @@
+package graphqlctest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leonardacademy/graphqlc"
+	"github.com/matryer/is"
+	"golang.org/x/net/websocket"
+)
+
+func collect(events chan graphqlc.SubscriptionEvent) []graphqlc.SubscriptionEvent {
+	var ret []graphqlc.SubscriptionEvent
+	for ev := range events {
+		ret = append(ret, ev)
+	}
+	return ret
+}
+
+func TestSubscriptionServer(t *testing.T) {
+	is := is.New(t)
+	srv := NewSubscriptionServer(t)
+	srv.Script().
+		KeepAlive().
+		Ack().
+		Data(map[string]interface{}{"n": 1}).
+		KeepAlive().
+		Error(map[string]interface{}{"message": "boom"}).
+		Data(map[string]interface{}{"n": 2}).
+		Complete()
+
+	client := graphqlc.NewClient(srv.URL)
+	req := graphqlc.NewRequest(`subscription OnN($min: Int) { n(min: $min) }`)
+	req.Var("min", 1)
+	events := make(chan graphqlc.SubscriptionEvent)
+	go client.Subscribe(context.Background(), req, events)
+	got := collect(events)
+
+	is.Equal(len(got), 3)
+	is.Equal(string(got[0].Data), `{"n":1}`)
+	is.Equal(got[1].Err.Error(), `{"message":"boom"}`)
+	is.Equal(string(got[2].Data), `{"n":2}`)
+
+	starts := srv.Await("start", 1, time.Second)
+	var payload struct {
+		Query     string
+		Variables map[string]interface{}
+	}
+	is.NoErr(json.Unmarshal(starts[0].Payload, &payload))
+	is.Equal(payload.Query, `subscription OnN($min: Int) { n(min: $min) }`)
+	is.Equal(payload.Variables["min"], float64(1))
+	stops := srv.Await("stop", 1, time.Second)
+	is.Equal(stops[0].ID, starts[0].ID)
+	is.Equal(srv.Messages()[0].Type, "connection_init")
+}
+
+func TestSubscriptionServerReconnect(t *testing.T) {
+	is := is.New(t)
+	srv := NewSubscriptionServer(t)
+	srv.Script().Ack().Data(map[string]interface{}{"n": 1}).Disconnect()
+	srv.Script().Ack().Data(map[string]interface{}{"n": 2}).Complete()
+
+	metrics := graphqlc.NewMemoryMetrics()
+	client := graphqlc.NewClient(srv.URL)
+	client.Metrics = metrics
+	client.MaxReconnects = 1
+	client.ReconnectWait = 10 * time.Millisecond
+	events := make(chan graphqlc.SubscriptionEvent)
+	go client.Subscribe(context.Background(), graphqlc.NewRequest(`subscription { n }`), events)
+	got := collect(events)
+
+	is.Equal(len(got), 2)
+	is.Equal(string(got[0].Data), `{"n":1}`)
+	is.Equal(string(got[1].Data), `{"n":2}`)
+	is.Equal(srv.Connections(), 2)
+	starts := srv.Await("start", 2, time.Second)
+	is.Equal(starts[0].Conn, 0)
+	is.Equal(starts[1].Conn, 1)
+	is.Equal(metrics.Snapshot().WebsocketReconnects, int64(1))
+	is.Equal(metrics.Snapshot().ActiveSubscriptions, int64(0))
+}
+
+func TestSubscriptionServerDisconnectWithoutReconnect(t *testing.T) {
+	is := is.New(t)
+	srv := NewSubscriptionServer(t)
+	srv.Script().Ack().AwaitStart().Disconnect()
+
+	client := graphqlc.NewClient(srv.URL)
+	events := make(chan graphqlc.SubscriptionEvent)
+	go client.Subscribe(context.Background(), graphqlc.NewRequest(`subscription { n }`), events)
+	got := collect(events)
+
+	is.Equal(len(got), 1)
+	is.True(got[0].Err != nil)
+	is.Equal(srv.Connections(), 1)
+}
+
+func TestSubscriptionServerCancel(t *testing.T) {
+	is := is.New(t)
+	srv := NewSubscriptionServer(t)
+	srv.Script().Ack().Data(map[string]interface{}{"n": 1})
+
+	client := graphqlc.NewClient(srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan graphqlc.SubscriptionEvent)
+	go client.Subscribe(ctx, graphqlc.NewRequest(`subscription { n }`), events)
+	ev := <-events
+	is.Equal(string(ev.Data), `{"n":1}`)
+	cancel()
+	collect(events)
+
+	starts := srv.Await("start", 1, time.Second)
+	stops := srv.Await("stop", 1, time.Second)
+	is.Equal(stops[0].ID, starts[0].ID)
+}
+
+func TestSubscriptionServerConnectionError(t *testing.T) {
+	is := is.New(t)
+	srv := NewSubscriptionServer(t)
+	srv.Script().ConnectionError("not allowed")
+
+	client := graphqlc.NewClient(srv.URL)
+	events := make(chan graphqlc.SubscriptionEvent)
+	go client.Subscribe(context.Background(), graphqlc.NewRequest(`subscription { n }`), events)
+	got := collect(events)
+	is.Equal(len(got), 1)
+	is.True(got[0].Err != nil)
+}
+
+func TestSubscriptionServerUnconsumedStarts(t *testing.T) {
+	is := is.New(t)
+	srv := NewSubscriptionServer(t)
+	srv.Script().Ack()
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http"), srv.URL)
+	is.NoErr(err)
+	config.Protocol = []string{"graphql-ws"}
+	ws, err := websocket.DialConfig(config)
+	is.NoErr(err)
+	is.NoErr(websocket.JSON.Send(ws, Message{Type: "connection_init"}))
+	// more starts than the script consumes
+	for i := 0; i < 40; i++ {
+		is.NoErr(websocket.JSON.Send(ws, Message{Type: "start", ID: fmt.Sprint(i)}))
+	}
+	is.Equal(len(srv.Await("start", 40, time.Second)), 40)
+	ws.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		srv.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection handler did not return")
+	}
+}
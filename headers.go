@@ -0,0 +1,45 @@
+package graphqlc
+
+import (
+	"context"
+	"net/http"
+)
+
+type headerKey struct{}
+
+// ContextWithHeader returns a copy of ctx carrying h, so that HTTP
+// middleware can propagate request IDs, tenants or session variables to the
+// operations run with the returned context. Headers already carried by ctx
+// are kept unless h sets them.
+//
+// Headers are merged in this order, later ones replacing earlier ones with
+// the same name: Client.Header, the Authorization header from the token
+// source, the headers of the context, then Request.Header.
+func ContextWithHeader(ctx context.Context, h http.Header) context.Context {
+	merged := HeaderFromContext(ctx).Clone()
+	if merged == nil {
+		merged = make(http.Header)
+	}
+	setHeaders(merged, h)
+	return context.WithValue(ctx, headerKey{}, merged)
+}
+
+// HeaderFromContext returns the headers carried by ctx, or nil. It must not
+// be modified.
+func HeaderFromContext(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headerKey{}).(http.Header)
+	return h
+}
+
+// setHeaders sets the headers of src on dst, replacing the values of dst.
+func setHeaders(dst, src http.Header) {
+	for key, values := range src {
+		if len(values) == 0 {
+			continue
+		}
+		dst.Set(key, values[0])
+		for _, value := range values[1:] {
+			dst.Add(key, value)
+		}
+	}
+}
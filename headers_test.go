@@ -0,0 +1,75 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/matryer/is"
+	"golang.org/x/net/websocket"
+)
+
+func TestContextHeaders(t *testing.T) {
+	is := is.New(t)
+	var got http.Header
+	client := NewClient("http://localhost/graphql", WithHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		io.WriteString(w, `{"data":{}}`)
+	})), WithTokenSource(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return &Token{AccessToken: "client-token"}, nil
+	})))
+	client.Header.Set("X-Tenant", "client")
+	client.Header.Set("X-Client", "1")
+
+	ctx := ContextWithHeader(context.Background(), http.Header{
+		"X-Request-Id":     {"r1"},
+		"X-Tenant":         {"ctx"},
+		"X-Hasura-Role":    {"user"},
+		"X-Hasura-User-Id": {"42"},
+	})
+	ctx = ContextWithHeader(ctx, http.Header{"X-Hasura-Role": {"editor"}})
+	req := NewRequest(`{ n }`)
+	req.Header.Set("X-Hasura-User-Id", "7")
+	is.NoErr(client.RunCtx(ctx, req))
+
+	is.Equal(got.Get("X-Client"), "1")
+	is.Equal(got.Get("Authorization"), "Bearer client-token")
+	is.Equal(got.Get("X-Request-Id"), "r1")
+	is.Equal(got.Get("X-Tenant"), "ctx")         // the context overrides the client
+	is.Equal(got.Get("X-Hasura-Role"), "editor") // the inner context overrides the outer one
+	is.Equal(got.Get("X-Hasura-User-Id"), "7")   // the request overrides the context
+
+	// a context can override the token source, to forward the caller's
+	// credentials
+	ctx = ContextWithHeader(ctx, http.Header{"Authorization": {"Bearer caller"}})
+	is.NoErr(client.RunCtx(ctx, NewRequest(`{ n }`)))
+	is.Equal(got.Get("Authorization"), "Bearer caller")
+	is.Equal(HeaderFromContext(context.Background()), nil)
+}
+
+func TestContextHeadersSubscription(t *testing.T) {
+	is := is.New(t)
+	server := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			is.Equal(r.Header.Get("X-Request-Id"), "r1")
+			config.Protocol = []string{"graphql-ws"}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			var m gowMsg
+			websocket.JSON.Receive(ws, &m) // connection_init
+			websocket.JSON.Send(ws, gowMsg{Type: "connection_ack"})
+			websocket.JSON.Receive(ws, &m) // start
+			websocket.JSON.Send(ws, gowMsg{Type: "complete", Id: m.Id})
+			websocket.JSON.Receive(ws, &m) // stop
+		},
+	}
+	client := NewClient("http://localhost/graphql", WithHandler(server))
+	ctx := ContextWithHeader(context.Background(), http.Header{"X-Request-Id": {"r1"}})
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(ctx, NewRequest("subscription { n }"), events)
+	for ev := range events {
+		is.NoErr(ev.Err)
+	}
+}
@@ -0,0 +1,186 @@
+package graphqlc
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hedging configures hedged requests, see WithHedging.
+type Hedging struct {
+	// Percentile of recent latencies after which a query is hedged.
+	// Defaults to 0.95.
+	Percentile float64
+	// MinDelay is the shortest wait before hedging, however fast recent
+	// queries were.
+	MinDelay time.Duration
+	// Budget caps hedged requests as a fraction of queries. Defaults to 0.1,
+	// so hedging adds at most 10% to the load.
+	Budget float64
+}
+
+const (
+	// hedgeSamples is the number of recent latencies the delay is computed
+	// from; queries are not hedged before hedgeMinSamples are known.
+	hedgeSamples    = 100
+	hedgeMinSamples = 10
+	// hedgeBurst is the most hedged requests the budget lets through at
+	// once.
+	hedgeBurst = 10
+)
+
+// WithHedging sends a second, hedged request for queries that take longer
+// than a percentile of recent query latencies. The first successful response
+// is used and the other request is cancelled. The hedged request goes to the
+// next endpoint if WithEndpoints is used, otherwise to the same one.
+// Mutations and requests with files are never hedged.
+func WithHedging(h Hedging) ClientOption {
+	return func(c *Client) {
+		if h.Percentile <= 0 || h.Percentile > 1 {
+			h.Percentile = 0.95
+		}
+		if h.Budget <= 0 {
+			h.Budget = 0.1
+		}
+		c.hedging = &hedger{cfg: h}
+	}
+}
+
+// hedger tracks query latencies and the hedging budget.
+type hedger struct {
+	cfg Hedging
+
+	mu        sync.Mutex
+	latencies []time.Duration // ring buffer
+	next      int
+	tokens    float64
+}
+
+// delay returns how long to wait before hedging, or false if there are not
+// enough latencies known yet.
+func (h *hedger) delay() (time.Duration, bool) {
+	h.mu.Lock()
+	latencies := append([]time.Duration(nil), h.latencies...)
+	h.mu.Unlock()
+	if len(latencies) < hedgeMinSamples {
+		return 0, false
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	d := latencies[int(h.cfg.Percentile*float64(len(latencies)-1))]
+	if d < h.cfg.MinDelay {
+		d = h.cfg.MinDelay
+	}
+	return d, true
+}
+
+// observe records the latency of a successful query.
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeSamples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgeSamples
+}
+
+// earn adds the budget share of a query.
+func (h *hedger) earn() {
+	h.mu.Lock()
+	h.tokens += h.cfg.Budget
+	if h.tokens > hedgeBurst {
+		h.tokens = hedgeBurst
+	}
+	h.mu.Unlock()
+}
+
+// spend reports whether the budget allows a hedged request, and takes it.
+func (h *hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+type attempt struct {
+	res    *http.Response
+	buf    []byte
+	err    error
+	op     *OperationInfo
+	meta   *Response
+	hedged bool
+}
+
+// sendHedged sends a query, hedging it if it is slow.
+func (c *Client) sendHedged(ctx context.Context, op *OperationInfo, req *Request, body *payload) (*http.Response, []byte, error) {
+	h := c.hedging
+	h.earn()
+	delay, ok := h.delay()
+	if !ok {
+		start := time.Now()
+		res, buf, err := c.sendEndpoints(ctx, op, req, body)
+		if err == nil && res.StatusCode < 500 {
+			h.observe(time.Since(start))
+		}
+		return res, buf, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan attempt, 2)
+	start := time.Now()
+	launch := func(hedged bool) {
+		// each attempt records its status and response in its own copies
+		a := attempt{op: new(OperationInfo), hedged: hedged}
+		*a.op = *op
+		attemptCtx := ctx
+		if responseFrom(ctx) != nil {
+			a.meta = &Response{}
+			attemptCtx = context.WithValue(ctx, responseKey{}, a.meta)
+		}
+		go func() {
+			a.res, a.buf, a.err = c.sendEndpoints(attemptCtx, a.op, req, body)
+			results <- a
+		}()
+	}
+	launch(false)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	var last attempt
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if h.spend() {
+				c.debug("sending hedged request", Field{"operation", op.Name}, Field{"delay", delay})
+				launch(true)
+				pending++
+			}
+			continue
+		case last = <-results:
+			pending--
+		}
+		if last.err == nil && last.res.StatusCode < 500 {
+			break
+		}
+	}
+	// only the winner is observed: the losing attempt was cancelled, and
+	// its latency is unknown
+	if last.err == nil && last.res.StatusCode < 500 {
+		h.observe(time.Since(start))
+		if last.hedged {
+			c.debug("hedged request won", Field{"operation", op.Name})
+		}
+	}
+	op.Status = last.op.Status
+	if last.meta != nil {
+		*responseFrom(ctx) = *last.meta
+	}
+	return last.res, last.buf, last.err
+}
@@ -0,0 +1,118 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestHedging(t *testing.T) {
+	is := is.New(t)
+	var calls, slow, cancelled int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// the server only notices a closed connection once the body is read
+		io.Copy(ioutil.Discard, r.Body)
+		delay := 5 * time.Millisecond
+		if atomic.CompareAndSwapInt32(&slow, 1, 0) {
+			delay = 500 * time.Millisecond
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			atomic.AddInt32(&cancelled, 1)
+			return
+		}
+		io.WriteString(w, `{"data":{"n":1}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithHedging(Hedging{Percentile: 0.9, MinDelay: 20 * time.Millisecond, Budget: 0.5}))
+	ctx := context.Background()
+
+	// not hedged until enough latencies are known
+	for i := 0; i < hedgeMinSamples; i++ {
+		is.NoErr(client.RunCtxRet(ctx, NewRequest(`{ n }`), nil))
+	}
+	is.Equal(atomic.LoadInt32(&calls), int32(hedgeMinSamples))
+
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&slow, 1)
+	start := time.Now()
+	var resp struct{ N int }
+	res, err := client.RunCtxResponse(ctx, NewRequest(`{ n }`), &resp)
+	is.NoErr(err)
+	is.Equal(resp.N, 1)
+	is.Equal(res.StatusCode, http.StatusOK)
+	is.True(time.Since(start) < 250*time.Millisecond) // the hedged request won
+	is.Equal(atomic.LoadInt32(&calls), int32(2))
+	time.Sleep(50 * time.Millisecond)
+	is.Equal(atomic.LoadInt32(&cancelled), int32(1)) // the slow one was cancelled
+
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&slow, 1)
+	is.NoErr(client.RunCtxRet(ctx, NewRequest(`mutation { n }`), nil))
+	is.Equal(atomic.LoadInt32(&calls), int32(1)) // mutations are never hedged
+}
+
+func TestHedgingBudget(t *testing.T) {
+	is := is.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n > hedgeMinSamples {
+			// every query is slower than the recent ones
+			time.Sleep(50 * time.Millisecond)
+		}
+		io.WriteString(w, `{"data":{"n":1}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, WithHedging(Hedging{Percentile: 0.5, Budget: 0.25}))
+	ctx := context.Background()
+	for i := 0; i < hedgeMinSamples; i++ {
+		is.NoErr(client.RunCtxRet(ctx, NewRequest(`{ n }`), nil))
+	}
+	// the budget earned while warming up
+	client.hedging.tokens = 0
+
+	atomic.StoreInt32(&calls, hedgeMinSamples)
+	for i := 0; i < 8; i++ {
+		is.NoErr(client.RunCtxRet(ctx, NewRequest(`{ n }`), nil))
+	}
+	is.Equal(atomic.LoadInt32(&calls)-hedgeMinSamples, int32(8+2)) // 25% more requests
+}
+
+func TestHedgingLoserNotMeasured(t *testing.T) {
+	is := is.New(t)
+	var slow int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		if atomic.CompareAndSwapInt32(&slow, 1, 0) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		io.WriteString(w, `{"data":{"n":1}}`)
+	}))
+	defer srv.Close()
+	client := NewClient("", WithEndpoints(Endpoints{URLs: []string{srv.URL}}),
+		WithHedging(Hedging{Percentile: 0.9, MinDelay: 100 * time.Millisecond, Budget: 0.5}))
+	ctx := context.Background()
+	for i := 0; i < hedgeMinSamples; i++ {
+		is.NoErr(client.RunCtxRet(ctx, NewRequest(`{ n }`), nil))
+	}
+	atomic.StoreInt32(&slow, 1)
+	is.NoErr(client.RunCtxRet(ctx, NewRequest(`{ n }`), nil))
+	time.Sleep(50 * time.Millisecond)
+	// the slow attempt, cancelled when the hedged one won, is not a
+	// latency sample: it would weigh at least 100ms / 5 in the average
+	is.True(client.endpoints.endpoints[0].avgLatency() < 20*time.Millisecond)
+}
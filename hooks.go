@@ -0,0 +1,121 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Hooks are called at various points during the lifetime of an operation
+// and can be used to plug graphqlc into tracing or monitoring systems.
+// Any of the functions may be nil.
+type Hooks struct {
+	// OperationStart is called before an operation is sent. The returned
+	// context is used for the rest of the operation, so it can carry a span
+	// or a TraceContext to be injected into outgoing requests.
+	OperationStart func(ctx context.Context, op *OperationInfo) context.Context
+
+	// OperationEnd is called once the operation has finished, with op.Err
+	// and op.Status filled in.
+	OperationEnd func(ctx context.Context, op *OperationInfo)
+
+	// HTTPAttempt is called after every HTTP round trip made for an
+	// operation.
+	HTTPAttempt func(ctx context.Context, op *OperationInfo, attempt *HTTPAttempt)
+
+	// WebsocketConnect is called after a subscription websocket has been
+	// dialed and initialised, or has failed to.
+	WebsocketConnect func(ctx context.Context, op *OperationInfo, endpoint string, err error)
+
+	// SubscriptionEvent is called for every event delivered to a subscriber.
+	SubscriptionEvent func(ctx context.Context, op *OperationInfo, event SubscriptionEvent)
+
+	// CircuitStateChange is called when the circuit breaker for endpoint
+	// changes state.
+	CircuitStateChange func(endpoint string, from, to BreakerState)
+}
+
+// OperationInfo describes a GraphQL operation as seen by Hooks.
+type OperationInfo struct {
+	// Name is the operation name, or empty for anonymous operations.
+	Name string
+	// Type is one of OperationQuery, OperationMutation or
+	// OperationSubscription.
+	Type string
+	// VariablesSize is the size of the JSON encoded variables in bytes.
+	VariablesSize int
+	// Start is the time the operation started.
+	Start time.Time
+	// Status is the HTTP status code of the last response, or 0 if none
+	// was received.
+	Status int
+	// Err is the error the operation ended with, if any.
+	Err error
+}
+
+// HTTPAttempt describes a single HTTP round trip.
+type HTTPAttempt struct {
+	Request    *http.Request
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+func newOperationInfo(req *Request) *OperationInfo {
+	op := &OperationInfo{Start: time.Now()}
+	op.Type, op.Name = parseOperation(req.q)
+	if len(req.vars) > 0 {
+		if b, err := json.Marshal(req.vars); err == nil {
+			op.VariablesSize = len(b)
+		}
+	}
+	return op
+}
+
+func (c *Client) startOperation(ctx context.Context, op *OperationInfo) context.Context {
+	if c.Hooks != nil && c.Hooks.OperationStart != nil {
+		if hctx := c.Hooks.OperationStart(ctx, op); hctx != nil {
+			return hctx
+		}
+	}
+	return ctx
+}
+
+func (c *Client) endOperation(ctx context.Context, op *OperationInfo, err error) {
+	op.Err = err
+	c.observeOperation(op)
+	if c.Hooks != nil && c.Hooks.OperationEnd != nil {
+		c.Hooks.OperationEnd(ctx, op)
+	}
+}
+
+func (c *Client) httpAttempt(ctx context.Context, op *OperationInfo, r *http.Request, res *http.Response, start time.Time, err error) {
+	if res != nil {
+		op.Status = res.StatusCode
+	}
+	if c.Hooks == nil || c.Hooks.HTTPAttempt == nil {
+		return
+	}
+	attempt := &HTTPAttempt{
+		Request:  r,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if res != nil {
+		attempt.StatusCode = res.StatusCode
+	}
+	c.Hooks.HTTPAttempt(ctx, op, attempt)
+}
+
+func (c *Client) websocketConnect(ctx context.Context, op *OperationInfo, endpoint string, err error) {
+	if c.Hooks != nil && c.Hooks.WebsocketConnect != nil {
+		c.Hooks.WebsocketConnect(ctx, op, endpoint, err)
+	}
+}
+
+func (c *Client) subscriptionEvent(ctx context.Context, op *OperationInfo, event SubscriptionEvent) {
+	if c.Hooks != nil && c.Hooks.SubscriptionEvent != nil {
+		c.Hooks.SubscriptionEvent(ctx, op, event)
+	}
+}
@@ -0,0 +1,65 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestHooks(t *testing.T) {
+	is := is.New(t)
+	tc := TraceContext{
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		TraceState:  "congo=t61rcWkgMzE",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("traceparent"), tc.TraceParent)
+		is.Equal(r.Header.Get("tracestate"), tc.TraceState)
+		io.WriteString(w, `{"errors":[{"message":"boom"}]}`)
+	}))
+	defer srv.Close()
+
+	var started, ended, attempts int
+	client := NewClient(srv.URL)
+	client.Hooks = &Hooks{
+		OperationStart: func(ctx context.Context, op *OperationInfo) context.Context {
+			started++
+			is.Equal(op.Name, "GetItems")
+			is.Equal(op.Type, OperationQuery)
+			is.Equal(op.VariablesSize, len(`{"id":1}`))
+			return ContextWithTraceContext(ctx, tc)
+		},
+		HTTPAttempt: func(ctx context.Context, op *OperationInfo, attempt *HTTPAttempt) {
+			attempts++
+			is.NoErr(attempt.Err)
+			is.Equal(attempt.StatusCode, http.StatusOK)
+		},
+		OperationEnd: func(ctx context.Context, op *OperationInfo) {
+			ended++
+			is.Equal(op.Status, http.StatusOK)
+			is.Equal(op.Err.Error(), "graphql: boom")
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	req := NewRequest(`query GetItems($id: Int) { items(id: $id) { id } }`)
+	req.Var("id", 1)
+	err := client.RunCtxRet(ctx, req, nil)
+	is.Equal(err.Error(), "graphql: boom")
+	is.Equal(started, 1)
+	is.Equal(attempts, 1)
+	is.Equal(ended, 1)
+}
+
+func TestTraceContextValid(t *testing.T) {
+	is := is.New(t)
+	is.True(TraceContext{TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}.Valid())
+	is.True(!TraceContext{TraceParent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}.Valid())
+	is.True(!TraceContext{TraceParent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}.Valid())
+	is.True(!TraceContext{TraceParent: "garbage"}.Valid())
+}
@@ -0,0 +1,214 @@
+package graphqlc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// WithHandler sends requests and subscriptions to h in-process, without
+// opening any sockets. Requests go through the same encoding, header merging
+// and error handling as over the network, so h sees exactly what a server
+// would. The Endpoint URL still sets the path and Host of requests.
+func WithHandler(h http.Handler) ClientOption {
+	return func(c *Client) {
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialHandler(h), nil
+		}
+		c.HttpClient = &http.Client{Transport: &http.Transport{
+			DialContext: dial,
+			// the connection is in memory: https endpoints skip TLS
+			DialTLSContext: dial,
+		}}
+		c.DialWebsocket = DialHandler(h)
+		if c.Endpoint == "" {
+			c.Endpoint = "http://localhost/"
+		}
+	}
+}
+
+// DialHandler returns a function for Client.DialWebsocket that connects
+// subscriptions to h in-process. h must accept websocket upgrades.
+func DialHandler(h http.Handler) func(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+	return func(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+		conn := dialHandler(h)
+		ws, err := websocket.NewClient(config, conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return ws, nil
+	}
+}
+
+// dialHandler returns a connection to an HTTP server running h.
+func dialHandler(h http.Handler) net.Conn {
+	client, server := newMemConns()
+	go http.Serve(&connListener{conn: server}, h)
+	return client
+}
+
+// connListener is a net.Listener that accepts a single connection, so that
+// http.Serve returns once it is being served.
+type connListener struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil, net.ErrClosed
+	}
+	conn := l.conn
+	l.conn = nil
+	return conn, nil
+}
+
+func (l *connListener) Close() error   { return nil }
+func (l *connListener) Addr() net.Addr { return memAddr{} }
+
+type memAddr struct{}
+
+func (memAddr) Network() string { return "memory" }
+func (memAddr) String() string  { return "memory" }
+
+// newMemConns returns the two ends of an in-memory connection. Unlike
+// net.Pipe, writes are buffered and never block, as with a socket, so both
+// ends may write at the same time.
+func newMemConns() (net.Conn, net.Conn) {
+	a, b := newMemBuffer(), newMemBuffer()
+	return &memConn{r: a, w: b}, &memConn{r: b, w: a}
+}
+
+// memBuffer carries the data flowing in one direction.
+type memBuffer struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	closed   bool // no more writes
+	done     bool // the reading end was closed
+	deadline time.Time
+	changed  chan struct{}
+}
+
+func newMemBuffer() *memBuffer {
+	return &memBuffer{changed: make(chan struct{})}
+}
+
+// signal wakes up a blocked reader. b.mu must be held.
+func (b *memBuffer) signal() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *memBuffer) read(p []byte) (int, error) {
+	for {
+		b.mu.Lock()
+		if b.done {
+			b.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		if b.buf.Len() > 0 {
+			n, _ := b.buf.Read(p)
+			b.mu.Unlock()
+			return n, nil
+		}
+		if b.closed {
+			b.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline, changed := b.deadline, b.changed
+		b.mu.Unlock()
+		if deadline.IsZero() {
+			<-changed
+			continue
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+func (b *memBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || b.done {
+		return 0, io.ErrClosedPipe
+	}
+	b.buf.Write(p)
+	b.signal()
+	return len(p), nil
+}
+
+func (b *memBuffer) setDeadline(t time.Time) {
+	b.mu.Lock()
+	b.deadline = t
+	b.signal()
+	b.mu.Unlock()
+}
+
+// closeWrite marks the end of the data; the reader gets io.EOF once it has
+// read everything.
+func (b *memBuffer) closeWrite() {
+	b.mu.Lock()
+	b.closed = true
+	b.signal()
+	b.mu.Unlock()
+}
+
+// closeRead discards the data and fails pending and future reads and
+// writes.
+func (b *memBuffer) closeRead() {
+	b.mu.Lock()
+	b.done = true
+	b.buf.Reset()
+	b.signal()
+	b.mu.Unlock()
+}
+
+// memConn is one end of an in-memory connection.
+type memConn struct {
+	r, w *memBuffer
+}
+
+func (c *memConn) Read(p []byte) (int, error)  { return c.r.read(p) }
+func (c *memConn) Write(p []byte) (int, error) { return c.w.write(p) }
+
+func (c *memConn) Close() error {
+	c.r.closeRead()
+	c.w.closeWrite()
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return memAddr{} }
+func (c *memConn) RemoteAddr() net.Addr { return memAddr{} }
+
+func (c *memConn) SetDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing: writes never block.
+func (c *memConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
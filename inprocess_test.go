@@ -0,0 +1,125 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"golang.org/x/net/websocket"
+)
+
+func TestWithHandler(t *testing.T) {
+	is := is.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		is.NoErr(json.NewDecoder(r.Body).Decode(&body))
+		is.Equal(r.Host, "api.example.com")
+		is.Equal(r.Header.Get("Content-Type"), "application/json; charset=utf-8")
+		is.Equal(r.Header.Get("X-Client"), "a")
+		is.Equal(r.Header.Get("X-Request"), "b")
+		if body.Variables["fail"] == true {
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, "bad gateway")
+			return
+		}
+		io.WriteString(w, `{"data":{"query":"`+body.Query+`"}}`)
+	})
+	client := NewClient("https://api.example.com/v1/graphql", WithHandler(mux))
+	client.Header.Set("X-Client", "a")
+
+	ctx := context.Background()
+	req := NewRequest("query { x }")
+	req.Header.Set("X-Request", "b")
+	var resp struct{ Query string }
+	is.NoErr(client.RunCtxRet(ctx, req, &resp))
+	is.Equal(resp.Query, "query { x }")
+
+	req.Var("fail", true)
+	err := client.RunCtxRet(ctx, req, nil)
+	is.Equal(err.Error(), "graphql: server returned a non-200 status code: 502")
+}
+
+func TestWithHandlerCancel(t *testing.T) {
+	is := is.New(t)
+	handlerDone := make(chan struct{})
+	client := NewClient("", WithHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+		close(handlerDone)
+	})))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.RunCtxRet(ctx, NewRequest("query { x }"), nil)
+	is.True(err != nil)
+	select {
+	case <-handlerDone:
+	case <-time.After(time.Second):
+		t.Fatal("handler was not cancelled")
+	}
+}
+
+func TestWithHandlerSubscription(t *testing.T) {
+	is := is.New(t)
+	server := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			config.Protocol = []string{"graphql-ws"}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			var m gowMsg
+			websocket.JSON.Receive(ws, &m) // connection_init
+			websocket.JSON.Send(ws, gowMsg{Type: "connection_ack"})
+			websocket.JSON.Receive(ws, &m) // start
+			for i := 1; i <= 2; i++ {
+				websocket.JSON.Send(ws, gowMsg{Type: "data", Id: m.Id, Payload: map[string]interface{}{"data": map[string]interface{}{"n": i}}})
+			}
+			websocket.JSON.Send(ws, gowMsg{Type: "complete", Id: m.Id})
+			websocket.JSON.Receive(ws, &m) // stop
+		},
+	}
+	client := NewClient("http://localhost/graphql", WithHandler(server))
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(context.Background(), NewRequest("subscription { n }"), events)
+	var got []string
+	for ev := range events {
+		is.NoErr(ev.Err)
+		got = append(got, string(ev.Data))
+	}
+	is.Equal(got, []string{`{"n":1}`, `{"n":2}`})
+}
+
+func TestMemConn(t *testing.T) {
+	is := is.New(t)
+	a, b := newMemConns()
+	// writes don't wait for the reader
+	_, err := a.Write([]byte("hello"))
+	is.NoErr(err)
+	_, err = b.Write([]byte("world"))
+	is.NoErr(err)
+	buf := make([]byte, 10)
+	n, err := b.Read(buf)
+	is.NoErr(err)
+	is.Equal(string(buf[:n]), "hello")
+
+	is.NoErr(a.SetReadDeadline(time.Now().Add(10 * time.Millisecond)))
+	n, err = a.Read(buf)
+	is.NoErr(err)
+	is.Equal(string(buf[:n]), "world")
+	_, err = a.Read(buf)
+	is.True(err.(interface{ Timeout() bool }).Timeout())
+
+	a.Close()
+	_, err = b.Read(buf)
+	is.Equal(err, io.EOF)
+	_, err = b.Write([]byte("x"))
+	is.Equal(err, io.ErrClosedPipe)
+}
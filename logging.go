@@ -0,0 +1,232 @@
+package graphqlc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+// Log levels, in increasing order of severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Field is a key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives structured log entries from a Client. Values that match
+// the Client's Redaction rules have already been replaced by Redacted.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// LoggerFunc adapts a function to the Logger interface.
+type LoggerFunc func(level Level, msg string, fields ...Field)
+
+// Log calls f.
+func (f LoggerFunc) Log(level Level, msg string, fields ...Field) {
+	f(level, msg, fields...)
+}
+
+// Redacted replaces secret values in logs.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers that are always redacted from logs.
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Hasura-Admin-Secret",
+	"X-Api-Key",
+}
+
+// Redaction controls which values are hidden from logs.
+type Redaction struct {
+	// Headers are redacted in addition to DefaultRedactedHeaders.
+	Headers []string
+
+	// Variables are dotted paths into the request variables whose values
+	// are redacted, such as "input.password". A "*" element matches any
+	// object key or array index, as in "users.*.token".
+	Variables []string
+
+	// Responses hides response bodies and subscription data.
+	Responses bool
+}
+
+// noopLog is the Log function set by NewClient, which discards its input.
+func noopLog(s string) {}
+
+// logFunc returns c.Log, or nil if it is unset or still noopLog, so that
+// entries are not formatted for nothing.
+func (c *Client) logFunc() func(s string) {
+	if c.Log == nil || reflect.ValueOf(c.Log).Pointer() == reflect.ValueOf(noopLog).Pointer() {
+		return nil
+	}
+	return c.Log
+}
+
+func (c *Client) logEnabled() bool {
+	return c.Logger != nil || c.logFunc() != nil
+}
+
+// log sends an entry to the Logger and the Log function, if set. Log
+// receives entries of every level, formatted as "msg key=value ...".
+func (c *Client) log(level Level, msg string, fields ...Field) {
+	if c.Logger != nil {
+		c.Logger.Log(level, msg, fields...)
+	}
+	if logf := c.logFunc(); logf != nil {
+		var b strings.Builder
+		b.WriteString(msg)
+		for _, f := range fields {
+			fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+		}
+		logf(b.String())
+	}
+}
+
+func (c *Client) debug(msg string, fields ...Field) {
+	c.log(LevelDebug, msg, fields...)
+}
+
+func (c *Client) isRedactedHeader(key string) bool {
+	for _, h := range DefaultRedactedHeaders {
+		if strings.EqualFold(h, key) {
+			return true
+		}
+	}
+	for _, h := range c.Redaction.Headers {
+		if strings.EqualFold(h, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeader returns a copy of h with secret headers redacted.
+func (c *Client) redactHeader(h http.Header) http.Header {
+	ret := make(http.Header, len(h))
+	for key, values := range h {
+		if c.isRedactedHeader(key) {
+			ret[key] = []string{Redacted}
+			continue
+		}
+		ret[key] = values
+	}
+	return ret
+}
+
+// redactVariables returns a copy of vars with the configured paths
+// redacted.
+func (c *Client) redactVariables(vars map[string]interface{}) interface{} {
+	if len(c.Redaction.Variables) == 0 || len(vars) == 0 {
+		return vars
+	}
+	b, err := json.Marshal(vars)
+	if err != nil {
+		return vars
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return vars
+	}
+	for _, path := range c.Redaction.Variables {
+		v = redactPath(v, strings.Split(path, "."))
+	}
+	return v
+}
+
+func redactPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return Redacted
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if path[0] == "*" || path[0] == key {
+				v[key] = redactPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				v[i] = redactPath(child, path[1:])
+			}
+		}
+	}
+	return v
+}
+
+// redactResponse hides a response body if Responses is set.
+func (c *Client) redactResponse(body string) string {
+	if c.Redaction.Responses {
+		return Redacted
+	}
+	return body
+}
+
+// redactMessage returns a copy of a graphql-ws message that is safe to log.
+func (c *Client) redactMessage(m gowMsg) string {
+	switch m.Type {
+	case "connection_init":
+		if payload, ok := m.Payload.(map[string]interface{}); ok {
+			redacted := make(map[string]interface{}, len(payload))
+			for key, value := range payload {
+				if c.isRedactedHeader(key) {
+					value = Redacted
+				} else if h, ok := value.(map[string]interface{}); ok && key == "headers" {
+					rh := make(map[string]interface{}, len(h))
+					for hk, hv := range h {
+						if c.isRedactedHeader(hk) {
+							hv = Redacted
+						}
+						rh[hk] = hv
+					}
+					value = rh
+				}
+				redacted[key] = value
+			}
+			m.Payload = redacted
+		}
+	case "start":
+		if payload, ok := m.Payload.(startPayload); ok {
+			m.Payload = struct {
+				Query     string      `json:"query"`
+				Variables interface{} `json:"variables"`
+			}{payload.Query, c.redactVariables(payload.Variables)}
+		}
+	case "data":
+		if c.Redaction.Responses {
+			m.Payload = Redacted
+		}
+	}
+	return jsonStr(m)
+}
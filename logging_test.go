@@ -0,0 +1,113 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestLoggerRedaction(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("Authorization"), "Bearer secret-token")
+		io.WriteString(w, `{"data":{"token":"response-secret"}}`)
+	}))
+	defer srv.Close()
+
+	type entry struct {
+		level  Level
+		msg    string
+		fields map[string]interface{}
+	}
+	var entries []entry
+	var lines []string
+	client := NewClient(srv.URL)
+	client.Logger = LoggerFunc(func(level Level, msg string, fields ...Field) {
+		e := entry{level, msg, make(map[string]interface{})}
+		for _, f := range fields {
+			e.fields[f.Key] = f.Value
+		}
+		entries = append(entries, e)
+	})
+	client.Log = func(s string) { lines = append(lines, s) }
+	client.Header.Set("Authorization", "Bearer secret-token")
+	client.Redaction = Redaction{
+		Headers:   []string{"X-Tenant-Secret"},
+		Variables: []string{"input.password", "users.*.token"},
+		Responses: true,
+	}
+
+	req := NewRequest(`mutation Login($input: LoginInput!) { login(input: $input) { token } }`)
+	req.Header.Set("X-Tenant-Secret", "tenant-secret")
+	req.Header.Set("X-Hasura-Admin-Secret", "admin-secret")
+	req.Var("input", map[string]interface{}{"user": "bob", "password": "hunter2"})
+	req.Var("users", []map[string]string{{"token": "t1"}, {"token": "t2"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	is.NoErr(client.RunCtxRet(ctx, req, nil))
+
+	is.Equal(len(entries), 2)
+	is.Equal(entries[0].level, LevelDebug)
+	is.Equal(entries[0].msg, "graphql request")
+	is.Equal(entries[0].fields["operation"], "Login")
+	headers := entries[0].fields["headers"].(http.Header)
+	is.Equal(headers.Get("Authorization"), Redacted)
+	is.Equal(headers.Get("X-Hasura-Admin-Secret"), Redacted)
+	is.Equal(headers.Get("X-Tenant-Secret"), Redacted)
+	is.Equal(headers.Get("Accept"), "application/json; charset=utf-8")
+	vars := entries[0].fields["variables"].(map[string]interface{})
+	is.Equal(vars["input"].(map[string]interface{})["user"], "bob")
+	is.Equal(vars["input"].(map[string]interface{})["password"], Redacted)
+	is.Equal(vars["users"].([]interface{})[1].(map[string]interface{})["token"], Redacted)
+	is.Equal(entries[1].fields["body"], Redacted)
+
+	// the request variables themselves are left untouched
+	is.Equal(req.vars["input"].(map[string]interface{})["password"], "hunter2")
+
+	is.Equal(len(lines), 2)
+	for _, line := range lines {
+		for _, secret := range []string{"secret-token", "admin-secret", "tenant-secret", "hunter2", "t1", "response-secret"} {
+			is.True(!strings.Contains(line, secret))
+		}
+	}
+}
+
+func TestRedactMessage(t *testing.T) {
+	is := is.New(t)
+	client := NewClient("http://localhost")
+	client.Redaction.Variables = []string{"key"}
+	init := gowMsg{Type: "connection_init", Payload: map[string]interface{}{
+		"Authorization": "Bearer a",
+		"headers":       map[string]interface{}{"x-hasura-admin-secret": "b", "x-hasura-role": "user"},
+	}}
+	is.Equal(client.redactMessage(init), `{"payload":{"Authorization":"[REDACTED]","headers":{"x-hasura-admin-secret":"[REDACTED]","x-hasura-role":"user"}},"id":"","type":"connection_init"}`)
+	start := gowMsg{Type: "start", Id: "1", Payload: startPayload{Query: "subscription { x }", Variables: map[string]interface{}{"key": "c"}}}
+	is.Equal(client.redactMessage(start), `{"payload":{"query":"subscription { x }","variables":{"key":"[REDACTED]"}},"id":"1","type":"start"}`)
+}
+
+func TestDefaultLog(t *testing.T) {
+	is := is.New(t)
+	client := NewClient("http://localhost/graphql", WithHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{}}`)
+	})))
+	is.True(client.Log != nil)
+	is.True(!client.logEnabled())
+	client.Log("discarded")
+
+	// wrapping the default Log keeps working
+	var lines []string
+	old := client.Log
+	client.Log = func(s string) {
+		old(s)
+		lines = append(lines, s)
+	}
+	is.True(client.logEnabled())
+	is.NoErr(client.RunCtx(context.Background(), NewRequest(`{ n }`)))
+	is.True(len(lines) > 0)
+}
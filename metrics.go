@@ -0,0 +1,259 @@
+package graphqlc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome classifies how an operation ended.
+type Outcome string
+
+const (
+	// OutcomeSuccess is an operation that returned no errors.
+	OutcomeSuccess Outcome = "success"
+	// OutcomeGraphQLError is an operation whose response carried errors.
+	OutcomeGraphQLError Outcome = "graphql_error"
+	// OutcomeHTTPError is an operation that got an unusable HTTP response.
+	OutcomeHTTPError Outcome = "http_error"
+	// OutcomeNetworkError is an operation that got no HTTP response at all.
+	OutcomeNetworkError Outcome = "network_error"
+)
+
+// Metrics receives measurements about the operations made by a Client.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveOperation records a finished query or mutation.
+	ObserveOperation(name string, outcome Outcome, d time.Duration)
+	// SubscriptionStarted and SubscriptionEnded track active
+	// subscriptions.
+	SubscriptionStarted()
+	SubscriptionEnded()
+	// WebsocketReconnect records a subscription re-dialing its websocket.
+	WebsocketReconnect()
+}
+
+// outcomeOf classifies a finished operation.
+func outcomeOf(op *OperationInfo) Outcome {
+	switch {
+	case op.Err == nil:
+		return OutcomeSuccess
+	case isGraphErr(op.Err):
+		return OutcomeGraphQLError
+	case op.Status == 0:
+		return OutcomeNetworkError
+	default:
+		return OutcomeHTTPError
+	}
+}
+
+func isGraphErr(err error) bool {
+	_, ok := err.(Error)
+	return ok
+}
+
+// DefaultBuckets are the latency histogram bounds, in seconds, used by
+// NewMemoryMetrics when none are given.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MemoryMetrics is an in-memory Metrics implementation. It can be published
+// with expvar.Publish, and serves the Prometheus text format over HTTP.
+type MemoryMetrics struct {
+	buckets []float64
+
+	mu                  sync.Mutex
+	operations          map[operationKey]*histogram
+	activeSubscriptions int64
+	reconnects          int64
+}
+
+type operationKey struct {
+	name    string
+	outcome Outcome
+}
+
+type histogram struct {
+	counts []uint64 // one per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewMemoryMetrics makes a new MemoryMetrics with the given latency buckets
+// in seconds, or DefaultBuckets if none are given.
+func NewMemoryMetrics(buckets ...float64) *MemoryMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &MemoryMetrics{
+		buckets:    b,
+		operations: make(map[operationKey]*histogram),
+	}
+}
+
+// ObserveOperation implements Metrics.
+func (m *MemoryMetrics) ObserveOperation(name string, outcome Outcome, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := operationKey{name, outcome}
+	h := m.operations[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.operations[key] = h
+	}
+	s := d.Seconds()
+	if i := sort.SearchFloat64s(m.buckets, s); i < len(m.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += s
+}
+
+// SubscriptionStarted implements Metrics.
+func (m *MemoryMetrics) SubscriptionStarted() {
+	m.mu.Lock()
+	m.activeSubscriptions++
+	m.mu.Unlock()
+}
+
+// SubscriptionEnded implements Metrics.
+func (m *MemoryMetrics) SubscriptionEnded() {
+	m.mu.Lock()
+	m.activeSubscriptions--
+	m.mu.Unlock()
+}
+
+// WebsocketReconnect implements Metrics.
+func (m *MemoryMetrics) WebsocketReconnect() {
+	m.mu.Lock()
+	m.reconnects++
+	m.mu.Unlock()
+}
+
+// MetricsSnapshot is a point in time copy of a MemoryMetrics.
+type MetricsSnapshot struct {
+	Operations          []OperationStats `json:"operations"`
+	ActiveSubscriptions int64            `json:"active_subscriptions"`
+	WebsocketReconnects int64            `json:"websocket_reconnects"`
+}
+
+// OperationStats are the measurements for one operation name and outcome.
+type OperationStats struct {
+	Name    string  `json:"operation"`
+	Outcome Outcome `json:"outcome"`
+	Count   uint64  `json:"count"`
+	// Sum is the total latency in seconds.
+	Sum float64 `json:"sum_seconds"`
+	// Buckets holds the cumulative count of operations at or under each
+	// upper bound, in seconds.
+	Buckets map[float64]uint64 `json:"-"`
+}
+
+// Snapshot returns the current measurements, sorted by operation name and
+// outcome.
+func (m *MemoryMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := MetricsSnapshot{
+		ActiveSubscriptions: m.activeSubscriptions,
+		WebsocketReconnects: m.reconnects,
+	}
+	for key, h := range m.operations {
+		stats := OperationStats{
+			Name:    key.name,
+			Outcome: key.outcome,
+			Count:   h.count,
+			Sum:     h.sum,
+			Buckets: make(map[float64]uint64, len(m.buckets)),
+		}
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += h.counts[i]
+			stats.Buckets[le] = cumulative
+		}
+		s.Operations = append(s.Operations, stats)
+	}
+	sort.Slice(s.Operations, func(i, j int) bool {
+		a, b := s.Operations[i], s.Operations[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Outcome < b.Outcome
+	})
+	return s
+}
+
+// String returns the snapshot as JSON, so that MemoryMetrics implements
+// expvar.Var.
+func (m *MemoryMetrics) String() string {
+	b, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// WritePrometheus writes the measurements in the Prometheus text exposition
+// format.
+func (m *MemoryMetrics) WritePrometheus(w io.Writer) error {
+	s := m.Snapshot()
+	var b strings.Builder
+	b.WriteString("# HELP graphqlc_operations_total Number of GraphQL operations by name and outcome.\n")
+	b.WriteString("# TYPE graphqlc_operations_total counter\n")
+	for _, op := range s.Operations {
+		fmt.Fprintf(&b, "graphqlc_operations_total{%s} %d\n", op.labels(), op.Count)
+	}
+	b.WriteString("# HELP graphqlc_operation_duration_seconds Latency of GraphQL operations by name and outcome.\n")
+	b.WriteString("# TYPE graphqlc_operation_duration_seconds histogram\n")
+	for _, op := range s.Operations {
+		labels := op.labels()
+		for _, le := range m.buckets {
+			fmt.Fprintf(&b, "graphqlc_operation_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(le), op.Buckets[le])
+		}
+		fmt.Fprintf(&b, "graphqlc_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, op.Count)
+		fmt.Fprintf(&b, "graphqlc_operation_duration_seconds_sum{%s} %s\n", labels, formatFloat(op.Sum))
+		fmt.Fprintf(&b, "graphqlc_operation_duration_seconds_count{%s} %d\n", labels, op.Count)
+	}
+	b.WriteString("# HELP graphqlc_active_subscriptions Number of subscriptions currently running.\n")
+	b.WriteString("# TYPE graphqlc_active_subscriptions gauge\n")
+	fmt.Fprintf(&b, "graphqlc_active_subscriptions %d\n", s.ActiveSubscriptions)
+	b.WriteString("# HELP graphqlc_websocket_reconnects_total Number of times a subscription re-dialed its websocket.\n")
+	b.WriteString("# TYPE graphqlc_websocket_reconnects_total counter\n")
+	fmt.Fprintf(&b, "graphqlc_websocket_reconnects_total %d\n", s.WebsocketReconnects)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the measurements in the Prometheus text exposition
+// format.
+func (m *MemoryMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+func (s OperationStats) labels() string {
+	return `operation="` + escapeLabel(s.Name) + `",outcome="` + escapeLabel(string(s.Outcome)) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func (c *Client) observeOperation(op *OperationInfo) {
+	if c.Metrics != nil && op.Type != OperationSubscription {
+		c.Metrics.ObserveOperation(op.Name, outcomeOf(op), time.Since(op.Start))
+	}
+}
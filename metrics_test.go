@@ -0,0 +1,86 @@
+package graphqlc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestMetrics(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Query string }
+		is.NoErr(json.NewDecoder(r.Body).Decode(&body))
+		switch {
+		case strings.Contains(body.Query, "Ok"):
+			io.WriteString(w, `{"data":{"value":"some data"}}`)
+		case strings.Contains(body.Query, "Bad"):
+			io.WriteString(w, `{"errors":[{"message":"bad"}]}`)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, `Bad Gateway`)
+		}
+	}))
+	defer srv.Close()
+
+	m := NewMemoryMetrics()
+	client := NewClient(srv.URL)
+	client.Metrics = m
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	is.NoErr(client.RunCtxRet(ctx, NewRequest(`query Ok { value }`), nil))
+	is.NoErr(client.RunCtxRet(ctx, NewRequest(`query Ok { value }`), nil))
+	is.True(client.RunCtxRet(ctx, NewRequest(`query Bad { value }`), nil) != nil)
+	is.True(client.RunCtxRet(ctx, NewRequest(`mutation Down { value }`), nil) != nil)
+	client.Endpoint = "http://127.0.0.1:0"
+	is.True(client.RunCtxRet(ctx, NewRequest(`mutation Down { value }`), nil) != nil)
+
+	s := m.Snapshot()
+	is.Equal(len(s.Operations), 4)
+	for i, want := range []struct {
+		name    string
+		outcome Outcome
+		count   uint64
+	}{
+		{"Bad", OutcomeGraphQLError, 1},
+		{"Down", OutcomeHTTPError, 1},
+		{"Down", OutcomeNetworkError, 1},
+		{"Ok", OutcomeSuccess, 2},
+	} {
+		is.Equal(s.Operations[i].Name, want.name)
+		is.Equal(s.Operations[i].Outcome, want.outcome)
+		is.Equal(s.Operations[i].Count, want.count)
+	}
+
+	var buf bytes.Buffer
+	is.NoErr(m.WritePrometheus(&buf))
+	out := buf.String()
+	is.True(strings.Contains(out, `graphqlc_operations_total{operation="Ok",outcome="success"} 2`))
+	is.True(strings.Contains(out, `graphqlc_operation_duration_seconds_bucket{operation="Ok",outcome="success",le="+Inf"} 2`))
+	is.True(strings.Contains(out, "graphqlc_active_subscriptions 0\n"))
+	is.True(strings.Contains(out, "graphqlc_websocket_reconnects_total 0\n"))
+
+	var snapshot MetricsSnapshot
+	is.NoErr(json.Unmarshal([]byte(m.String()), &snapshot))
+	is.Equal(len(snapshot.Operations), 4)
+}
+
+func TestMemoryMetricsBuckets(t *testing.T) {
+	is := is.New(t)
+	m := NewMemoryMetrics(1, 0.1)
+	m.ObserveOperation("Q", OutcomeSuccess, 50*time.Millisecond)
+	m.ObserveOperation("Q", OutcomeSuccess, 500*time.Millisecond)
+	m.ObserveOperation("Q", OutcomeSuccess, 5*time.Second)
+	op := m.Snapshot().Operations[0]
+	is.Equal(op.Buckets[0.1], uint64(1))
+	is.Equal(op.Buckets[1], uint64(2))
+	is.Equal(op.Count, uint64(3))
+}
@@ -0,0 +1,92 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClientCredentials is a TokenSource that fetches tokens with the OAuth2
+// client credentials grant, as used by Auth0 and most identity providers.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	// Audience is sent as the audience parameter if set.
+	Audience string
+	Scopes   []string
+	// EndpointParams are additional parameters sent to TokenURL.
+	EndpointParams url.Values
+	// HttpClient is used to fetch tokens, http.DefaultClient if nil.
+	HttpClient *http.Client
+}
+
+// Token implements TokenSource.
+func (cc *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	form := url.Values{}
+	for key, values := range cc.EndpointParams {
+		form[key] = values
+	}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", cc.ClientID)
+	form.Set("client_secret", cc.ClientSecret)
+	if cc.Audience != "" {
+		form.Set("audience", cc.Audience)
+	}
+	if len(cc.Scopes) > 0 {
+		form.Set("scope", strings.Join(cc.Scopes, " "))
+	}
+	r, err := http.NewRequest(http.MethodPost, cc.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+	httpClient := cc.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(r.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading token response")
+	}
+	var tr struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil && res.StatusCode == http.StatusOK {
+		return nil, errors.Wrap(err, "decoding token response")
+	}
+	if res.StatusCode != http.StatusOK || tr.Error != "" {
+		if tr.Error != "" {
+			return nil, fmt.Errorf("oauth2: %s: %s", tr.Error, tr.ErrorDescription)
+		}
+		return nil, fmt.Errorf("oauth2: token endpoint returned a non-200 status code: %v", res.StatusCode)
+	}
+	if tr.AccessToken == "" {
+		return nil, errors.New("oauth2: server response missing access_token")
+	}
+	tok := &Token{
+		AccessToken: tr.AccessToken,
+		TokenType:   tr.TokenType,
+	}
+	if tr.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
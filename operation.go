@@ -0,0 +1,51 @@
+package graphqlc
+
+import "strings"
+
+// Operation types as they appear in a GraphQL document.
+const (
+	OperationQuery        = "query"
+	OperationMutation     = "mutation"
+	OperationSubscription = "subscription"
+)
+
+// parseOperation returns the type and name of the first operation defined
+// in the document q, or empty strings if q can't be parsed. A document that
+// starts with a bare selection set is an anonymous query.
+func parseOperation(q string) (typ, name string) {
+	doc, err := parseDocumentAST(q)
+	if err != nil {
+		return "", ""
+	}
+	if op := doc.operation(); op != nil {
+		return op.kind, op.name
+	}
+	return "", ""
+}
+
+// Operation returns the type and name of the operation in the request's
+// query. The type is empty if the query could not be understood.
+func (req *Request) Operation() (typ, name string) {
+	return parseOperation(req.q)
+}
+
+// NormalizeQuery returns q with comments removed and whitespace collapsed,
+// so that queries differing only in formatting compare equal. Tokens are
+// separated by a single space where the whitespace between them matters.
+func NormalizeQuery(q string) string {
+	var b strings.Builder
+	l := &lexer{q: q}
+	prev := ""
+	for l.next(); l.tok != ""; l.next() {
+		if l.skipped && prev != "" && !isPunctuatorToken(prev) && !isPunctuatorToken(l.tok) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(l.tok)
+		prev = l.tok
+	}
+	return b.String()
+}
+
+func isPunctuatorToken(tok string) bool {
+	return tok == "..." || (len(tok) == 1 && isPunctuator(tok[0]))
+}
@@ -0,0 +1,68 @@
+package graphqlc
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParseOperation(t *testing.T) {
+	is := is.New(t)
+	for _, tc := range []struct {
+		q, typ, name string
+	}{
+		{`{ items { id } }`, OperationQuery, ""},
+		{`query { items { id } }`, OperationQuery, ""},
+		{`query GetItems($id: ID!) { items(id: $id) { id } }`, OperationQuery, "GetItems"},
+		{"  # leading comment\n mutation AddItem { add { id } }", OperationMutation, "AddItem"},
+		{`subscription OnItem{ item { id } }`, OperationSubscription, "OnItem"},
+		{`fragment F on Item { id query } query Q { items { ...F } }`, OperationQuery, "Q"},
+		{`query Q($s: String = "{") { items(s: $s) { id } }`, OperationQuery, "Q"},
+		{"\ufeffquery Q { items { id } }", OperationQuery, "Q"},
+		{`query Q { items / 2 }`, "", ""},
+		{`query Q { items { id }`, "", ""},
+	} {
+		typ, name := parseOperation(tc.q)
+		is.Equal(typ, tc.typ)
+		is.Equal(name, tc.name)
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	is := is.New(t)
+	is.Equal(NormalizeQuery(`
+		# fetch a user
+		query GetUser($id: ID!, $full: Boolean = false) {
+			user(id: $id) {
+				...UserFields
+				name @include(if: $full)
+				bio(format: "a  b")
+			}
+		}
+	`), `query GetUser($id:ID!$full:Boolean=false){user(id:$id){...UserFields name@include(if:$full)bio(format:"a  b")}}`)
+	is.Equal(NormalizeQuery("{ a b }"), NormalizeQuery("{\n  a,\n  b\n}"))
+}
+
+func TestTokenizersAgree(t *testing.T) {
+	is := is.New(t)
+	// the byte order mark is skipped and "/" is not a token, whatever reads
+	// the document
+	q := "\ufeff# user\nquery GetUser { user { id } }"
+	typ, name := parseOperation(q)
+	is.Equal(typ, OperationQuery)
+	is.Equal(name, "GetUser")
+	is.Equal(NormalizeQuery(q), "query GetUser{user{id}}")
+	_, err := Analyze(q, nil, CostOptions{})
+	is.NoErr(err)
+	defs, _, err := parseDocument(q)
+	is.NoErr(err)
+	is.Equal(defs[0].text, "query GetUser { user { id } }")
+
+	q = "query GetUser { user { id / name } }"
+	typ, _ = parseOperation(q)
+	is.Equal(typ, "")
+	_, err = Analyze(q, nil, CostOptions{})
+	is.Equal(err.Error(), `graphql: syntax error at offset 26: unexpected character "/"`)
+	_, _, err = parseDocument(q)
+	is.Equal(err.Error(), `graphql: syntax error at offset 26: unexpected character "/"`)
+}
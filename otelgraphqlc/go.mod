@@ -0,0 +1,23 @@
+module github.com/leonardacademy/graphqlc/otelgraphqlc
+
+go 1.21
+
+require (
+	github.com/leonardacademy/graphqlc v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/gofrs/uuid v3.2.0+incompatible // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
+
+replace github.com/leonardacademy/graphqlc => ../
@@ -0,0 +1,115 @@
+// Package otelgraphqlc adapts graphqlc Hooks to OpenTelemetry tracing.
+//
+// It lives in its own module so that the core graphqlc package stays free of
+// OpenTelemetry dependencies.
+//
+//  client := graphqlc.NewClient(endpoint)
+//  client.Hooks = otelgraphqlc.NewHooks()
+package otelgraphqlc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leonardacademy/graphqlc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/leonardacademy/graphqlc/otelgraphqlc"
+
+// Option configures the hooks returned by NewHooks.
+type Option func(*config)
+
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// WithTracerProvider sets the TracerProvider used to create spans. The
+// global provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) { c.provider = tp }
+}
+
+// WithPropagator sets the propagator used to produce the traceparent and
+// tracestate headers. A W3C trace-context propagator is used by default.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) { c.propagator = p }
+}
+
+// NewHooks returns graphqlc Hooks that record a client span for every
+// operation and propagate it to the server.
+func NewHooks(opts ...Option) *graphqlc.Hooks {
+	cfg := config{
+		provider:   otel.GetTracerProvider(),
+		propagator: propagation.TraceContext{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	tracer := cfg.provider.Tracer(instrumentationName)
+	return &graphqlc.Hooks{
+		OperationStart: func(ctx context.Context, op *graphqlc.OperationInfo) context.Context {
+			ctx, _ = tracer.Start(ctx, spanName(op),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithTimestamp(op.Start),
+				trace.WithAttributes(
+					attribute.String("graphql.operation.name", op.Name),
+					attribute.String("graphql.operation.type", op.Type),
+					attribute.Int("graphql.variables.size", op.VariablesSize),
+				))
+			carrier := propagation.MapCarrier{}
+			cfg.propagator.Inject(ctx, carrier)
+			return graphqlc.ContextWithTraceContext(ctx, graphqlc.TraceContext{
+				TraceParent: carrier.Get("traceparent"),
+				TraceState:  carrier.Get("tracestate"),
+			})
+		},
+		OperationEnd: func(ctx context.Context, op *graphqlc.OperationInfo) {
+			span := trace.SpanFromContext(ctx)
+			if op.Status != 0 {
+				span.SetAttributes(attribute.Int("http.response.status_code", op.Status))
+			}
+			if op.Err != nil {
+				span.RecordError(op.Err)
+				span.SetStatus(codes.Error, op.Err.Error())
+			}
+			span.End()
+		},
+		HTTPAttempt: func(ctx context.Context, op *graphqlc.OperationInfo, a *graphqlc.HTTPAttempt) {
+			attrs := []attribute.KeyValue{
+				attribute.Int("http.response.status_code", a.StatusCode),
+				attribute.Int64("http.duration_ms", a.Duration.Milliseconds()),
+			}
+			if a.Err != nil {
+				attrs = append(attrs, attribute.String("error", a.Err.Error()))
+			}
+			trace.SpanFromContext(ctx).AddEvent("http.attempt", trace.WithAttributes(attrs...))
+		},
+		WebsocketConnect: func(ctx context.Context, op *graphqlc.OperationInfo, endpoint string, err error) {
+			attrs := []attribute.KeyValue{attribute.String("server.address", endpoint)}
+			if err != nil {
+				attrs = append(attrs, attribute.String("error", err.Error()))
+			}
+			trace.SpanFromContext(ctx).AddEvent("websocket.connect", trace.WithAttributes(attrs...))
+		},
+		SubscriptionEvent: func(ctx context.Context, op *graphqlc.OperationInfo, ev graphqlc.SubscriptionEvent) {
+			attrs := []attribute.KeyValue{attribute.Int("graphql.data.size", len(ev.Data))}
+			if ev.Err != nil {
+				attrs = append(attrs, attribute.String("error", ev.Err.Error()))
+			}
+			trace.SpanFromContext(ctx).AddEvent("subscription.event", trace.WithAttributes(attrs...))
+		},
+	}
+}
+
+func spanName(op *graphqlc.OperationInfo) string {
+	if op.Name == "" {
+		return fmt.Sprintf("graphql %s", op.Type)
+	}
+	return fmt.Sprintf("graphql %s %s", op.Type, op.Name)
+}
@@ -0,0 +1,208 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Paginator iterates over the nodes of a Relay connection, fetching pages as
+// they are needed.
+//
+//  req := graphqlc.NewRequest(`
+//      query ($after: String) {
+//          users(first: 100, after: $after) {
+//              edges { cursor node { id name } }
+//              pageInfo { endCursor hasNextPage }
+//          }
+//      }
+//  `)
+//  p := client.Paginate(ctx, req, "after", "users")
+//  for p.Next() {
+//      var user User
+//      if err := p.Decode(&user); err != nil {
+//          return err
+//      }
+//  }
+//  if err := p.Err(); err != nil {
+//      return err
+//  }
+//
+// Connections listing nodes directly, as "nodes" rather than "edges", are
+// supported too.
+type Paginator struct {
+	c         *Client
+	ctx       context.Context
+	req       *Request
+	cursorVar string
+	path      string
+	backward  bool
+
+	edges   []pageEdge
+	current pageEdge
+	pages   int
+	last    bool
+	// stop is returned once the current page is used up.
+	stop error
+	err  error
+}
+
+type pageEdge struct {
+	Cursor string
+	Node   json.RawMessage
+}
+
+type connection struct {
+	Edges    []pageEdge
+	Nodes    []json.RawMessage
+	PageInfo struct {
+		StartCursor     *string
+		EndCursor       *string
+		HasNextPage     bool
+		HasPreviousPage bool
+	}
+}
+
+// Paginate returns a Paginator over the connection at path in the data of
+// the responses to req. Path is a dotted list of keys, with list indexes in
+// brackets, such as "organization.members" or "repos[0].issues". cursorVar
+// is the variable that receives pageInfo.endCursor to fetch the next page;
+// if req already sets it, paging starts from there. req itself is not
+// modified.
+func (c *Client) Paginate(ctx context.Context, req *Request, cursorVar, path string) *Paginator {
+	return &Paginator{
+		c:         c,
+		ctx:       ctx,
+		req:       req,
+		cursorVar: cursorVar,
+		path:      path,
+	}
+}
+
+// Backward makes p page backward, passing pageInfo.startCursor in the cursor
+// variable while pageInfo.hasPreviousPage is set. Nodes are then returned
+// last first. It must be called before Next.
+func (p *Paginator) Backward() *Paginator {
+	p.backward = true
+	return p
+}
+
+// Next advances to the next node, fetching the next page if needed. It
+// returns false when there are no more nodes or an error occurred, see Err.
+func (p *Paginator) Next() bool {
+	if p.err != nil {
+		return false
+	}
+	if err := p.ctx.Err(); err != nil {
+		p.err = err
+		return false
+	}
+	for len(p.edges) == 0 {
+		if p.last {
+			p.err = p.stop
+			return false
+		}
+		if err := p.fetch(); err != nil {
+			p.err = err
+			return false
+		}
+	}
+	p.current, p.edges = p.edges[0], p.edges[1:]
+	return true
+}
+
+// fetch requests the next page.
+func (p *Paginator) fetch() error {
+	var data json.RawMessage
+	if err := p.c.RunCtxRet(p.ctx, p.req, &data); err != nil {
+		return err
+	}
+	raw, err := lookupPath(data, p.path)
+	if err != nil {
+		return err
+	}
+	var conn connection
+	if err := json.Unmarshal(raw, &conn); err != nil {
+		return errors.Wrapf(err, "graphql: decoding connection %q", p.path)
+	}
+	p.pages++
+	edges := conn.Edges
+	if edges == nil {
+		for _, node := range conn.Nodes {
+			edges = append(edges, pageEdge{Node: node})
+		}
+	}
+	if p.backward {
+		for i, j := 0, len(edges)-1; i < j; i, j = i+1, j-1 {
+			edges[i], edges[j] = edges[j], edges[i]
+		}
+	}
+	p.edges = edges
+
+	more, cursor := conn.PageInfo.HasNextPage, conn.PageInfo.EndCursor
+	if p.backward {
+		more, cursor = conn.PageInfo.HasPreviousPage, conn.PageInfo.StartCursor
+	}
+	if !more {
+		p.last = true
+		return nil
+	}
+	if cursor == nil || *cursor == "" {
+		p.last = true
+		p.stop = errors.Errorf("graphql: connection %q has more pages but no cursor", p.path)
+		return nil
+	}
+	if prev, ok := p.req.vars[p.cursorVar]; ok && prev == *cursor {
+		p.last = true
+		p.stop = errors.Errorf("graphql: connection %q returned the same cursor twice", p.path)
+		return nil
+	}
+	next := p.req.clone()
+	next.Var(p.cursorVar, *cursor)
+	p.req = next
+	return nil
+}
+
+// Decode decodes the current node into v.
+func (p *Paginator) Decode(v interface{}) error {
+	return json.Unmarshal(p.current.Node, v)
+}
+
+// Node returns the current node as raw JSON.
+func (p *Paginator) Node() json.RawMessage {
+	return p.current.Node
+}
+
+// Cursor returns the cursor of the current edge. It is empty for
+// connections listing nodes directly.
+func (p *Paginator) Cursor() string {
+	return p.current.Cursor
+}
+
+// Pages returns the number of pages fetched so far.
+func (p *Paginator) Pages() int {
+	return p.pages
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (p *Paginator) Err() error {
+	return p.err
+}
+
+// clone returns a copy of req with its own variables and headers.
+func (req *Request) clone() *Request {
+	r := &Request{
+		q:      req.q,
+		files:  req.files,
+		Header: req.Header.Clone(),
+	}
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	for key, value := range req.vars {
+		r.Var(key, value)
+	}
+	return r
+}
@@ -0,0 +1,131 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// newConnectionServer serves the users 1 to n in pages of size, with the
+// page selected by the after or before variable.
+func newConnectionServer(t *testing.T, n, size int, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		var body struct {
+			Variables map[string]string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		first, last := 1, size
+		if after, ok := body.Variables["after"]; ok {
+			fmt.Sscan(after, &first)
+			first++
+			last = first + size - 1
+		}
+		if before, ok := body.Variables["before"]; ok {
+			fmt.Sscan(before, &last)
+			last--
+			first = last - size + 1
+		} else if _, ok := body.Variables["after"]; !ok && strings.Contains(r.Header.Get("X-Direction"), "backward") {
+			first, last = n-size+1, n
+		}
+		if first < 1 {
+			first = 1
+		}
+		if last > n {
+			last = n
+		}
+		var edges []string
+		for i := first; i <= last; i++ {
+			edges = append(edges, fmt.Sprintf(`{"cursor":"%d","node":{"id":%d}}`, i, i))
+		}
+		fmt.Fprintf(w, `{"data":{"org":{"users":{"edges":[%s],"pageInfo":{"startCursor":"%d","endCursor":"%d","hasNextPage":%v,"hasPreviousPage":%v}}}}}`,
+			strings.Join(edges, ","), first, last, last < n, first > 1)
+	}))
+}
+
+func TestPaginate(t *testing.T) {
+	is := is.New(t)
+	var requests int
+	srv := newConnectionServer(t, 5, 2, &requests)
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	req := NewRequest(`query ($after: String) { org { users(first: 2, after: $after) { edges { cursor node { id } } pageInfo { endCursor hasNextPage } } } }`)
+	p := client.Paginate(context.Background(), req, "after", "org.users")
+	var ids []int
+	for p.Next() {
+		var user struct{ ID int }
+		is.NoErr(p.Decode(&user))
+		is.Equal(p.Cursor(), fmt.Sprint(user.ID))
+		ids = append(ids, user.ID)
+		if len(ids) == 1 {
+			is.Equal(requests, 1) // pages are fetched lazily
+		}
+	}
+	is.NoErr(p.Err())
+	is.Equal(ids, []int{1, 2, 3, 4, 5})
+	is.Equal(p.Pages(), 3)
+	is.Equal(requests, 3)
+	_, ok := req.Vars()["after"]
+	is.True(!ok) // the caller's request is left alone
+}
+
+func TestPaginateBackward(t *testing.T) {
+	is := is.New(t)
+	var requests int
+	srv := newConnectionServer(t, 5, 2, &requests)
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	req := NewRequest(`query ($before: String) { org { users(last: 2, before: $before) { edges { cursor node { id } } pageInfo { startCursor hasPreviousPage } } } }`)
+	req.Header.Set("X-Direction", "backward")
+	p := client.Paginate(context.Background(), req, "before", "org.users").Backward()
+	var ids []int
+	for p.Next() {
+		var user struct{ ID int }
+		is.NoErr(p.Decode(&user))
+		ids = append(ids, user.ID)
+	}
+	is.NoErr(p.Err())
+	is.Equal(ids, []int{5, 4, 3, 2, 1})
+}
+
+func TestPaginateCancel(t *testing.T) {
+	is := is.New(t)
+	var requests int
+	srv := newConnectionServer(t, 100, 2, &requests)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewClient(srv.URL)
+	p := client.Paginate(ctx, NewRequest(`query ($after: String) { org { users { edges { node { id } } } } }`), "after", "org.users")
+	is.True(p.Next())
+	cancel()
+	is.True(!p.Next())
+	is.Equal(p.Err(), context.Canceled)
+	is.Equal(requests, 1)
+}
+
+func TestPaginateNodes(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"repos":[{"issues":{"nodes":[{"n":1},{"n":2}],"pageInfo":{"hasNextPage":true,"endCursor":""}}}]}}`)
+	}))
+	defer srv.Close()
+
+	p := NewClient(srv.URL).Paginate(context.Background(), NewRequest(`query { x }`), "after", "repos[0].issues")
+	is.True(p.Next())
+	is.Equal(string(p.Node()), `{"n":1}`)
+	is.Equal(p.Cursor(), "")
+	is.True(p.Next())
+	is.True(!p.Next())
+	is.Equal(p.Err().Error(), `graphql: connection "repos[0].issues" has more pages but no cursor`)
+}
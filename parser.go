@@ -0,0 +1,434 @@
+package graphqlc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// lexer splits a GraphQL document into tokens. It is the only tokenizer of
+// the package: the parser, NormalizeQuery and the document loader all use
+// it, so that they agree on what a token is.
+type lexer struct {
+	q   string
+	pos int
+	// tok is the current token: a punctuator, name, number or string, or
+	// a single character that is none of these. It is empty at the end of
+	// the document.
+	tok   string
+	start int
+	// skipped is set if whitespace or comments come before tok.
+	skipped bool
+	// keepComments makes next collect the comments it skips in comments.
+	keepComments bool
+	comments     []lexComment
+}
+
+// lexComment is a comment skipped by the lexer, "#" included.
+type lexComment struct {
+	start int
+	text  string
+}
+
+// next moves to the next token, skipping whitespace, commas, comments and
+// byte order marks.
+func (l *lexer) next() {
+	q := l.q
+	l.skipped = false
+	for l.pos < len(q) {
+		c := q[l.pos]
+		switch {
+		case isIgnored(c):
+			l.pos++
+		case strings.HasPrefix(q[l.pos:], "\ufeff"):
+			l.pos += len("\ufeff")
+		case c == '#':
+			start := l.pos
+			for l.pos < len(q) && q[l.pos] != '\n' && q[l.pos] != '\r' {
+				l.pos++
+			}
+			if l.keepComments {
+				l.comments = append(l.comments, lexComment{start: start, text: q[start:l.pos]})
+			}
+		default:
+			l.start = l.pos
+			l.scan()
+			return
+		}
+		l.skipped = true
+	}
+	l.start = l.pos
+	l.tok = ""
+}
+
+// scan reads the token starting at l.pos.
+func (l *lexer) scan() {
+	q := l.q
+	c := q[l.pos]
+	switch {
+	case strings.HasPrefix(q[l.pos:], "..."):
+		l.pos += 3
+	case isPunctuator(c):
+		l.pos++
+	case c == '"':
+		l.pos = skipString(q, l.pos)
+	case isNameStart(c):
+		for l.pos < len(q) && isNameChar(q[l.pos]) {
+			l.pos++
+		}
+	case c == '-' || (c >= '0' && c <= '9'):
+		// trailing name characters are kept in the token, making it an
+		// invalid number rather than a number followed by a name
+		for l.pos++; l.pos < len(q); l.pos++ {
+			d := q[l.pos]
+			exp := (d == '+' || d == '-') && (q[l.pos-1] == 'e' || q[l.pos-1] == 'E')
+			if !isNameChar(d) && d != '.' && !exp {
+				break
+			}
+		}
+	default:
+		_, size := utf8.DecodeRuneInString(q[l.pos:])
+		l.pos += size
+	}
+	l.tok = q[l.start:l.pos]
+}
+
+// valid reports whether tok is a GraphQL token.
+func (l *lexer) valid() bool {
+	c := l.tok[0]
+	return l.tok == "..." || (len(l.tok) == 1 && isPunctuator(c)) || c == '"' || isNameStart(c) || c == '-' || (c >= '0' && c <= '9')
+}
+
+// skipString returns the index just past the string literal starting at i.
+func skipString(q string, i int) int {
+	if strings.HasPrefix(q[i:], `"""`) {
+		end := strings.Index(q[i+3:], `"""`)
+		for end >= 0 && q[i+3+end-1] == '\\' {
+			next := strings.Index(q[i+3+end+1:], `"""`)
+			if next < 0 {
+				return len(q)
+			}
+			end += next + 1
+		}
+		if end < 0 {
+			return len(q)
+		}
+		return i + 3 + end + 3
+	}
+	for i++; i < len(q); i++ {
+		switch q[i] {
+		case '\\':
+			i++
+		case '"', '\n':
+			return i + 1
+		}
+	}
+	return len(q)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func isIgnored(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ','
+}
+
+// isPunctuator reports whether c is a single character punctuator.
+func isPunctuator(c byte) bool {
+	return strings.IndexByte("!$&():=@[]{}|", c) >= 0
+}
+
+// astDocument is a parsed document, keeping what the package needs:
+// definitions with their selections, and the scalar arguments of fields.
+type astDocument struct {
+	definitions []*astDefinition
+}
+
+// astDefinition is an operation or fragment definition.
+type astDefinition struct {
+	// kind is "fragment" or an operation type.
+	kind string
+	// name is empty for anonymous operations.
+	name       string
+	selections []astSelection
+	// start and end are the offsets of the definition in the document,
+	// from its first token to its closing brace.
+	start, end int
+}
+
+// operation returns the first operation of the document, or nil.
+func (d *astDocument) operation() *astDefinition {
+	for _, def := range d.definitions {
+		if def.kind != "fragment" {
+			return def
+		}
+	}
+	return nil
+}
+
+// astSelection is a field, a fragment spread or an inline fragment.
+type astSelection struct {
+	field  *astField
+	spread string
+	inline []astSelection
+}
+
+type astField struct {
+	name       string
+	args       map[string]interface{}
+	selections []astSelection
+}
+
+// astVariable is a variable used as an argument value.
+type astVariable string
+
+// spreads calls f with the name of every fragment spread in sels, in
+// document order.
+func spreads(sels []astSelection, f func(name string)) {
+	for _, sel := range sels {
+		switch {
+		case sel.field != nil:
+			spreads(sel.field.selections, f)
+		case sel.spread != "":
+			f(sel.spread)
+		default:
+			spreads(sel.inline, f)
+		}
+	}
+}
+
+// parser is a recursive descent parser for GraphQL documents.
+type parser struct {
+	lexer
+	// end is the offset just past the last closing brace of a selection
+	// set.
+	end int
+}
+
+// parseError is a syntax error in a document.
+type parseError struct {
+	offset int
+	msg    string
+}
+
+func (e parseError) Error() string {
+	return fmt.Sprintf("graphql: syntax error at offset %d: %s", e.offset, e.msg)
+}
+
+func parseDocumentAST(q string) (*astDocument, error) {
+	return parseWith(&parser{lexer: lexer{q: q}})
+}
+
+// parseWith parses the document of p.
+func parseWith(p *parser) (doc *astDocument, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(parseError)
+			if !ok {
+				panic(r)
+			}
+			err = perr
+		}
+	}()
+	p.next()
+	doc = &astDocument{}
+	for p.tok != "" {
+		def := &astDefinition{start: p.start}
+		switch p.tok {
+		case "{":
+			def.kind = OperationQuery
+		case OperationQuery, OperationMutation, OperationSubscription:
+			def.kind = p.tok
+			p.next()
+			if p.tok != "" && isNameStart(p.tok[0]) {
+				def.name = p.name()
+			}
+			if p.tok == "(" {
+				p.skipBalanced("(", ")")
+			}
+			p.directives()
+		case "fragment":
+			def.kind = p.tok
+			p.next()
+			def.name = p.name()
+			p.expect("on")
+			p.name()
+			p.directives()
+		default:
+			p.fail("unexpected %q", p.tok)
+		}
+		def.selections = p.selectionSet()
+		def.end = p.end
+		doc.definitions = append(doc.definitions, def)
+	}
+	return doc, nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(parseError{offset: p.start, msg: fmt.Sprintf(format, args...)})
+}
+
+// next moves to the next token, failing on characters that can't start
+// one.
+func (p *parser) next() {
+	p.lexer.next()
+	if p.tok != "" && !p.valid() {
+		p.fail("unexpected character %q", p.tok)
+	}
+}
+
+func (p *parser) expect(tok string) {
+	if p.tok != tok {
+		if p.tok == "" {
+			p.fail("expected %q, got the end of the document", tok)
+		}
+		p.fail("expected %q, got %q", tok, p.tok)
+	}
+	p.next()
+}
+
+func (p *parser) name() string {
+	if p.tok == "" {
+		p.fail("expected a name, got the end of the document")
+	}
+	if !isNameStart(p.tok[0]) {
+		p.fail("expected a name, got %q", p.tok)
+	}
+	name := p.tok
+	p.next()
+	return name
+}
+
+func (p *parser) skipBalanced(open, close string) {
+	depth := 0
+	for {
+		switch p.tok {
+		case open:
+			depth++
+		case close:
+			depth--
+		case "":
+			p.fail("unbalanced %q", open)
+		}
+		p.next()
+		if depth == 0 {
+			return
+		}
+	}
+}
+
+func (p *parser) directives() {
+	for p.tok == "@" {
+		p.next()
+		p.name()
+		if p.tok == "(" {
+			p.arguments()
+		}
+	}
+}
+
+func (p *parser) selectionSet() []astSelection {
+	p.expect("{")
+	var sels []astSelection
+	for p.tok != "}" {
+		if p.tok == "" {
+			p.fail("expected \"}\", got the end of the document")
+		}
+		sels = append(sels, p.selection())
+	}
+	p.end = p.pos
+	p.next()
+	return sels
+}
+
+func (p *parser) selection() astSelection {
+	if p.tok == "..." {
+		p.next()
+		if p.tok == "on" {
+			p.next()
+			p.name()
+		} else if p.tok != "@" && p.tok != "{" {
+			spread := p.name()
+			p.directives()
+			return astSelection{spread: spread}
+		}
+		p.directives()
+		return astSelection{inline: p.selectionSet()}
+	}
+	f := &astField{name: p.name()}
+	if p.tok == ":" {
+		p.next()
+		f.name = p.name()
+	}
+	if p.tok == "(" {
+		f.args = p.arguments()
+	}
+	p.directives()
+	if p.tok == "{" {
+		f.selections = p.selectionSet()
+	}
+	return astSelection{field: f}
+}
+
+func (p *parser) arguments() map[string]interface{} {
+	p.expect("(")
+	args := make(map[string]interface{})
+	for p.tok != ")" {
+		name := p.name()
+		p.expect(":")
+		args[name] = p.value()
+	}
+	p.next()
+	return args
+}
+
+// value parses a value. Only scalars and variables are kept; lists and
+// objects are skipped.
+func (p *parser) value() interface{} {
+	tok := p.tok
+	switch {
+	case tok == "$":
+		p.next()
+		return astVariable(p.name())
+	case tok == "[":
+		p.skipBalanced("[", "]")
+		return nil
+	case tok == "{":
+		p.skipBalanced("{", "}")
+		return nil
+	case tok == "":
+		p.fail("expected a value, got the end of the document")
+	case tok[0] == '"':
+		p.next()
+		return tok
+	case tok[0] == '-' || (tok[0] >= '0' && tok[0] <= '9'):
+		p.next()
+		if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+			return n
+		}
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			p.fail("invalid number %q", tok)
+		}
+		return f
+	case isNameStart(tok[0]):
+		p.next()
+		switch tok {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return tok
+	}
+	p.fail("unexpected %q", tok)
+	return nil
+}
@@ -0,0 +1,83 @@
+package graphqlc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// lookupPath returns the value at path in the JSON document data. Path is
+// a dotted list of keys, where list elements are selected with an index,
+// either as a key or in brackets: "users.0.name" or "users[0].name". A null
+// along the way yields null.
+func lookupPath(data []byte, path string) (json.RawMessage, error) {
+	keys, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	v := json.RawMessage(data)
+	for i, key := range keys {
+		trimmed := bytes.TrimSpace(v)
+		if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+			return json.RawMessage("null"), nil
+		}
+		at := strings.Join(keys[:i+1], ".")
+		if trimmed[0] == '[' {
+			n, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, errors.Errorf("graphql: %q is a list, not an object", strings.Join(keys[:i], "."))
+			}
+			var list []json.RawMessage
+			if err := json.Unmarshal(trimmed, &list); err != nil {
+				return nil, errors.Wrapf(err, "graphql: decoding %q", at)
+			}
+			if n < 0 || n >= len(list) {
+				return nil, errors.Errorf("graphql: no %q in response, the list has %d elements", at, len(list))
+			}
+			v = list[n]
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &obj); err != nil {
+			return nil, errors.Wrapf(err, "graphql: decoding %q", at)
+		}
+		child, ok := obj[key]
+		if !ok {
+			return nil, errors.Errorf("graphql: no %q in response", at)
+		}
+		v = child
+	}
+	return v, nil
+}
+
+// splitPath splits a path such as "a.b[0].c" into its keys.
+func splitPath(path string) ([]string, error) {
+	var keys []string
+	for _, part := range strings.Split(path, ".") {
+		for {
+			i := strings.IndexByte(part, '[')
+			if i < 0 {
+				break
+			}
+			if i > 0 {
+				keys = append(keys, part[:i])
+			}
+			j := strings.IndexByte(part, ']')
+			if j < i {
+				return nil, errors.Errorf("graphql: invalid path %q", path)
+			}
+			keys = append(keys, part[i+1:j])
+			part = part[j+1:]
+		}
+		if part != "" {
+			keys = append(keys, part)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("graphql: invalid path %q", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,399 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+// Proxy is an http.Handler that forwards GraphQL requests through a Client,
+// so they get its authentication, endpoints, retries, limits and logging:
+//
+//  upstream := graphqlc.NewClient("https://hasura.internal/v1/graphql", opts...)
+//  proxy := graphqlc.NewProxy(upstream)
+//  proxy.ForwardHeaders = []string{"X-Request-Id", "X-Hasura-Role"}
+//  http.Handle("/graphql", proxy)
+//
+// Queries and mutations are accepted as JSON POST requests, or GET requests
+// with query and variables parameters. With Subscriptions set, graphql-ws
+// websocket connections are accepted too, each subscription being forwarded
+// with Client.Subscribe.
+//
+// Upstream GraphQL responses are passed on with their status. Failures to
+// get one are answered with a 502, or a 503 if the client's circuit breaker
+// is open or its rate limit can't be waited for.
+type Proxy struct {
+	Client *Client
+
+	// ForwardHeaders are the headers of incoming requests sent upstream.
+	// They are attached to the context of operations, see
+	// ContextWithHeader. For subscriptions, they are taken from the
+	// handshake and the headers of the connection_init payload.
+	ForwardHeaders []string
+
+	// Allow, if set, is called before an operation is forwarded, with the
+	// incoming request or websocket handshake. An error refuses the
+	// operation.
+	Allow func(r *http.Request, req *Request) error
+
+	// Rewrite, if set, is called after Allow and may change the variables
+	// or headers of req. An error refuses the operation.
+	Rewrite func(r *http.Request, req *Request) error
+
+	// MaxBodyBytes limits the size of the body of incoming requests.
+	// Larger requests are refused with 413 Request Entity Too Large.
+	// Defaults to DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+
+	// Subscriptions accepts websocket connections for subscriptions. The
+	// handshake is accepted from any origin: check r.Header in Allow if
+	// needed.
+	Subscriptions bool
+}
+
+// DefaultMaxBodyBytes is the default Proxy.MaxBodyBytes.
+const DefaultMaxBodyBytes = 1 << 20
+
+// NewProxy returns a Proxy forwarding requests through c.
+func NewProxy(c *Client) *Proxy {
+	return &Proxy{Client: c}
+}
+
+// AllowQueries returns a Proxy.Allow function that only lets through the
+// given documents. Queries are compared once normalized with NormalizeQuery,
+// so they must match an allowed document up to comments and whitespace,
+// whatever their operation name.
+func AllowQueries(queries ...string) func(r *http.Request, req *Request) error {
+	allowed := make(map[string]bool)
+	for _, q := range queries {
+		allowed[NormalizeQuery(q)] = true
+	}
+	return func(r *http.Request, req *Request) error {
+		if !allowed[NormalizeQuery(req.q)] {
+			if _, name := req.Operation(); name != "" {
+				return errors.Errorf("graphql: operation %q is not allowed", name)
+			}
+			return errors.New("graphql: query is not allowed")
+		}
+		return nil
+	}
+}
+
+// proxyRequest is the body of an incoming request.
+type proxyRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.Subscriptions && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		p.serveWebsocket(w, r)
+		return
+	}
+	var in proxyRequest
+	switch r.Method {
+	case http.MethodGet:
+		in.Query = r.URL.Query().Get("query")
+		in.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &in.Variables); err != nil {
+				writeProxyError(w, http.StatusBadRequest, errors.Wrap(err, "graphql: decoding variables"))
+				return
+			}
+		}
+	case http.MethodPost:
+		max := p.MaxBodyBytes
+		if max <= 0 {
+			max = DefaultMaxBodyBytes
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+		if err != nil {
+			status := http.StatusBadRequest
+			if _, ok := err.(*http.MaxBytesError); ok {
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeProxyError(w, status, errors.Wrap(err, "graphql: reading request"))
+			return
+		}
+		if err := json.Unmarshal(body, &in); err != nil {
+			writeProxyError(w, http.StatusBadRequest, errors.Wrap(err, "graphql: decoding request"))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeProxyError(w, http.StatusMethodNotAllowed, errors.New("graphql: method not allowed"))
+		return
+	}
+	req, status, err := p.prepare(r, in)
+	if err != nil {
+		writeProxyError(w, status, err)
+		return
+	}
+	if typ, _ := req.Operation(); typ == OperationSubscription {
+		writeProxyError(w, http.StatusBadRequest, errors.New("graphql: subscriptions require a websocket"))
+		return
+	}
+	if r.Method == http.MethodGet && !isQuery(req) {
+		w.Header().Set("Allow", "POST")
+		writeProxyError(w, http.StatusMethodNotAllowed, errors.New("graphql: mutations require POST"))
+		return
+	}
+
+	res, err := p.Client.RunCtxResponse(p.context(r.Context(), r.Header, nil), req, nil)
+	if res == nil {
+		writeProxyError(w, proxyErrorStatus(err), err)
+		return
+	}
+	out := map[string]json.RawMessage{}
+	if res.Data != nil {
+		out["data"] = res.Data
+	}
+	if res.Errors != nil {
+		out["errors"] = res.Errors
+	}
+	if res.Extensions != nil {
+		out["extensions"] = res.Extensions
+	}
+	if len(out) == 0 && err != nil {
+		// not a GraphQL response: upstream errors are passed on, but a
+		// success status with a body that can't be decoded is a bad gateway
+		status := res.StatusCode
+		if status < 400 {
+			status = http.StatusBadGateway
+		}
+		writeProxyError(w, status, err)
+		return
+	}
+	writeProxyJSON(w, res.StatusCode, out)
+}
+
+// proxyErrorStatus returns the status to respond with when the upstream
+// request failed with err before getting a response.
+func proxyErrorStatus(err error) int {
+	switch cause := errors.Cause(err); cause.(type) {
+	case *LimitError:
+		return http.StatusBadRequest
+	case *rateLimitError:
+		return http.StatusServiceUnavailable
+	default:
+		if cause == ErrCircuitOpen {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusBadGateway
+	}
+}
+
+// prepare builds the upstream request for in, received with r, and runs the
+// Allow and Rewrite hooks. It returns the status to respond with on error.
+func (p *Proxy) prepare(r *http.Request, in proxyRequest) (*Request, int, error) {
+	if strings.TrimSpace(in.Query) == "" {
+		return nil, http.StatusBadRequest, errors.New("graphql: missing query")
+	}
+	req := NewRequest(in.Query)
+	for key, value := range in.Variables {
+		req.Var(key, value)
+	}
+	if _, name := req.Operation(); in.OperationName != "" && in.OperationName != name {
+		return nil, http.StatusBadRequest, errors.Errorf("graphql: operation %q must be the first of the document", in.OperationName)
+	}
+	if p.Allow != nil {
+		if err := p.Allow(r, req); err != nil {
+			return nil, http.StatusForbidden, err
+		}
+	}
+	if p.Rewrite != nil {
+		if err := p.Rewrite(r, req); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	return req, 0, nil
+}
+
+// context returns ctx carrying the forwarded headers, from header then
+// extra.
+func (p *Proxy) context(ctx context.Context, header, extra http.Header) context.Context {
+	forwarded := make(http.Header)
+	for _, name := range p.ForwardHeaders {
+		name = http.CanonicalHeaderKey(name)
+		if values := extra[name]; len(values) > 0 {
+			forwarded[name] = values
+		} else if values := header[name]; len(values) > 0 {
+			forwarded[name] = values
+		}
+	}
+	if len(forwarded) == 0 {
+		return ctx
+	}
+	return ContextWithHeader(ctx, forwarded)
+}
+
+func isQuery(req *Request) bool {
+	typ, _ := req.Operation()
+	return typ == OperationQuery
+}
+
+func writeProxyError(w http.ResponseWriter, status int, err error) {
+	writeProxyJSON(w, status, map[string]interface{}{
+		"errors": []map[string]interface{}{{"message": err.Error()}},
+	})
+}
+
+func writeProxyJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// serveWebsocket serves a graphql-ws connection.
+func (p *Proxy) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	server := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			for _, protocol := range config.Protocol {
+				if protocol == "graphql-ws" {
+					config.Protocol = []string{protocol}
+					return nil
+				}
+			}
+			return errors.New("graphql: unsupported websocket protocol")
+		},
+		Handler: func(ws *websocket.Conn) {
+			(&proxyConn{p: p, ws: ws, r: r, subs: make(map[string]*proxySub)}).serve()
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// proxyConn is a graphql-ws connection served by a Proxy.
+type proxyConn struct {
+	p  *Proxy
+	ws *websocket.Conn
+	r  *http.Request
+	// header holds the headers of the connection_init payload.
+	header http.Header
+
+	sendMu sync.Mutex
+	mu     sync.Mutex
+	subs   map[string]*proxySub
+	wg     sync.WaitGroup
+}
+
+// proxySub is a subscription forwarded on a proxyConn.
+type proxySub struct {
+	cancel context.CancelFunc
+}
+
+func (pc *proxyConn) send(m gowMsg) {
+	pc.sendMu.Lock()
+	defer pc.sendMu.Unlock()
+	websocket.JSON.Send(pc.ws, m)
+}
+
+func (pc *proxyConn) serve() {
+	ctx, cancel := context.WithCancel(pc.r.Context())
+	defer func() {
+		cancel()
+		pc.wg.Wait()
+		pc.ws.Close()
+	}()
+	for {
+		var m struct {
+			ID      string          `json:"id"`
+			Type    string          `json:"type"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := websocket.JSON.Receive(pc.ws, &m); err != nil {
+			return
+		}
+		switch m.Type {
+		case "connection_init":
+			var init struct {
+				Headers map[string]interface{} `json:"headers"`
+			}
+			json.Unmarshal(m.Payload, &init)
+			pc.header = make(http.Header)
+			for key, value := range init.Headers {
+				if s, ok := value.(string); ok {
+					pc.header.Set(key, s)
+				}
+			}
+			pc.send(gowMsg{Type: "connection_ack"})
+		case "start":
+			var in proxyRequest
+			if err := json.Unmarshal(m.Payload, &in); err != nil {
+				pc.send(gowMsg{Type: "error", Id: m.ID, Payload: map[string]string{"message": err.Error()}})
+				continue
+			}
+			pc.start(ctx, m.ID, in)
+		case "stop":
+			pc.mu.Lock()
+			if sub, ok := pc.subs[m.ID]; ok {
+				sub.cancel()
+				delete(pc.subs, m.ID)
+			}
+			pc.mu.Unlock()
+		case "connection_terminate":
+			return
+		}
+	}
+}
+
+// start forwards the subscription id.
+func (pc *proxyConn) start(ctx context.Context, id string, in proxyRequest) {
+	req, _, err := pc.p.prepare(pc.r, in)
+	if err != nil {
+		pc.send(gowMsg{Type: "error", Id: id, Payload: map[string]string{"message": err.Error()}})
+		return
+	}
+	ctx, cancel := context.WithCancel(pc.p.context(ctx, pc.r.Header, pc.header))
+	sub := &proxySub{cancel: cancel}
+	pc.mu.Lock()
+	if old, ok := pc.subs[id]; ok {
+		// a client reusing an id replaces the subscription
+		old.cancel()
+	}
+	pc.subs[id] = sub
+	pc.mu.Unlock()
+
+	events := make(chan SubscriptionEvent)
+	if typ, _ := req.Operation(); typ != OperationSubscription {
+		// queries and mutations may be sent over the websocket too
+		go func() {
+			defer close(events)
+			var data json.RawMessage
+			if err := pc.p.Client.RunCtxRet(ctx, req, &data); err != nil {
+				events <- SubscriptionEvent{Err: err}
+				return
+			}
+			events <- SubscriptionEvent{Data: data}
+		}()
+	} else {
+		go pc.p.Client.Subscribe(ctx, req, events)
+	}
+	pc.wg.Add(1)
+	go func() {
+		defer pc.wg.Done()
+		for ev := range events {
+			if ev.Err != nil {
+				pc.send(gowMsg{Type: "error", Id: id, Payload: map[string]string{"message": ev.Err.Error()}})
+				continue
+			}
+			pc.send(gowMsg{Type: "data", Id: id, Payload: map[string]json.RawMessage{"data": ev.Data}})
+		}
+		if ctx.Err() == nil {
+			pc.send(gowMsg{Type: "complete", Id: id})
+		}
+		cancel()
+		pc.mu.Lock()
+		if pc.subs[id] == sub {
+			delete(pc.subs, id)
+		}
+		pc.mu.Unlock()
+	}()
+}
@@ -0,0 +1,193 @@
+package graphqlc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"golang.org/x/net/websocket"
+)
+
+func TestProxy(t *testing.T) {
+	is := is.New(t)
+	var got struct {
+		Query     string
+		Variables map[string]interface{}
+	}
+	var gotHeader http.Header
+	upstream := NewClient("http://hasura/v1/graphql", WithHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		if strings.Contains(got.Query, "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"errors":[{"message":"not found","extensions":{"code":"not-found"}}]}`)
+			return
+		}
+		io.WriteString(w, `{"data":{"user":{"id":1}},"extensions":{"cost":2}}`)
+	})))
+	upstream.Header.Set("X-Hasura-Admin-Secret", "s3cret")
+	proxy := NewProxy(upstream)
+	proxy.ForwardHeaders = []string{"x-request-id"}
+	proxy.Allow = AllowQueries(
+		"query GetUser($id: Int!) { user(id: $id) { id } }",
+		"query Missing { missing { id } }",
+		"mutation Rename { rename }",
+		`query GetUser {
+			# the GET request
+			user { id }
+		}`,
+	)
+	proxy.Rewrite = func(r *http.Request, req *Request) error {
+		req.Var("tenant", r.Header.Get("X-Tenant"))
+		return nil
+	}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	post := func(body string) (int, string) {
+		r, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		is.NoErr(err)
+		r.Header.Set("X-Request-Id", "r1")
+		r.Header.Set("X-Tenant", "acme")
+		r.Header.Set("X-Other", "dropped")
+		res, err := http.DefaultClient.Do(r)
+		is.NoErr(err)
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		is.NoErr(err)
+		return res.StatusCode, strings.TrimSpace(string(b))
+	}
+
+	status, body := post(`{"query":"query GetUser($id: Int!) { user(id: $id) { id } }","variables":{"id":1},"operationName":"GetUser"}`)
+	is.Equal(status, http.StatusOK)
+	is.Equal(body, `{"data":{"user":{"id":1}},"extensions":{"cost":2}}`)
+	is.Equal(got.Variables, map[string]interface{}{"id": float64(1), "tenant": "acme"})
+	is.Equal(gotHeader.Get("X-Request-Id"), "r1")
+	is.Equal(gotHeader.Get("X-Hasura-Admin-Secret"), "s3cret")
+	is.Equal(gotHeader.Get("X-Other"), "")
+
+	status, body = post(`{"query":"query Missing { missing { id } }"}`)
+	is.Equal(status, http.StatusNotFound)
+	is.Equal(body, `{"errors":[{"message":"not found","extensions":{"code":"not-found"}}]}`)
+
+	got.Query = ""
+	status, body = post(`{"query":"mutation DropAll { drop_all }"}`)
+	is.Equal(status, http.StatusForbidden)
+	is.Equal(body, `{"errors":[{"message":"graphql: operation \"DropAll\" is not allowed"}]}`)
+	is.Equal(got.Query, "") // not forwarded
+
+	// the name of an allowed operation does not let another document through
+	status, body = post(`{"query":"query GetUser { users { id password } }","operationName":"GetUser"}`)
+	is.Equal(status, http.StatusForbidden)
+	is.Equal(body, `{"errors":[{"message":"graphql: operation \"GetUser\" is not allowed"}]}`)
+	status, body = post(`{"query":"{ users { id } }"}`)
+	is.Equal(status, http.StatusForbidden)
+	is.Equal(body, `{"errors":[{"message":"graphql: query is not allowed"}]}`)
+	is.Equal(got.Query, "")
+
+	status, _ = post(`not json`)
+	is.Equal(status, http.StatusBadRequest)
+
+	proxy.MaxBodyBytes = 64
+	got.Query = ""
+	status, body = post(`{"query":"query GetUser($id: Int!) { user(id: $id) { id } }","variables":{"id":1}}`)
+	is.Equal(status, http.StatusRequestEntityTooLarge)
+	is.Equal(body, `{"errors":[{"message":"graphql: reading request: http: request body too large"}]}`)
+	is.Equal(got.Query, "")
+	proxy.MaxBodyBytes = 0
+
+	res, err := http.Get(srv.URL + "?query=" + url.QueryEscape("mutation Rename { rename }"))
+	is.NoErr(err)
+	res.Body.Close()
+	is.Equal(res.StatusCode, http.StatusMethodNotAllowed)
+
+	res, err = http.Get(srv.URL + "?query=" + url.QueryEscape("query GetUser { user { id } }"))
+	is.NoErr(err)
+	res.Body.Close()
+	is.Equal(res.StatusCode, http.StatusOK)
+}
+
+func TestProxyUpstreamErrors(t *testing.T) {
+	is := is.New(t)
+	var fail bool
+	handler := WithHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, `<html>maintenance</html>`)
+	}))
+	post := func(upstream *Client) int {
+		proxy := NewProxy(upstream)
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"query":"{ user { id } }"}`))
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+		defer cancel()
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r.WithContext(ctx))
+		return w.Code
+	}
+
+	limited := NewClient("http://hasura/v1/graphql", handler, WithRateLimit(RateLimit{Rate: 0.1}))
+	is.Equal(post(limited), http.StatusBadGateway)         // a 200 that is not a GraphQL response
+	is.Equal(post(limited), http.StatusServiceUnavailable) // the next token is 10s away
+
+	fail = true
+	broken := NewClient("http://hasura/v1/graphql", handler, WithCircuitBreaker(CircuitBreaker{MinRequests: 1}))
+	is.Equal(post(broken), http.StatusInternalServerError)
+	is.Equal(post(broken), http.StatusServiceUnavailable) // the circuit breaker is open
+}
+
+func TestProxySubscriptions(t *testing.T) {
+	is := is.New(t)
+	upstreamServer := websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			is.Equal(r.Header.Get("X-Request-Id"), "r1")
+			config.Protocol = []string{"graphql-ws"}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			var m struct {
+				gowMsg
+				Payload startPayload `json:"payload"`
+			}
+			websocket.JSON.Receive(ws, &m) // connection_init
+			websocket.JSON.Send(ws, gowMsg{Type: "connection_ack"})
+			websocket.JSON.Receive(ws, &m) // start
+			is.Equal(m.Payload.Variables["tenant"], "acme")
+			for i := 1; i <= 2; i++ {
+				websocket.JSON.Send(ws, gowMsg{Type: "data", Id: m.Id, Payload: map[string]interface{}{"data": map[string]interface{}{"n": i}}})
+			}
+			websocket.JSON.Send(ws, gowMsg{Type: "complete", Id: m.Id})
+			websocket.JSON.Receive(ws, &m) // stop
+		},
+	}
+	proxy := NewProxy(NewClient("http://hasura/v1/graphql", WithHandler(upstreamServer)))
+	proxy.Subscriptions = true
+	proxy.ForwardHeaders = []string{"X-Request-Id"}
+	proxy.Rewrite = func(r *http.Request, req *Request) error {
+		req.Var("tenant", "acme")
+		return nil
+	}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	ctx := ContextWithHeader(context.Background(), http.Header{"X-Request-Id": {"r1"}})
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(ctx, NewRequest("subscription { n }"), events)
+	var got []string
+	for ev := range events {
+		is.NoErr(ev.Err)
+		got = append(got, string(ev.Data))
+	}
+	is.Equal(got, []string{`{"n":1}`, `{"n":2}`})
+}
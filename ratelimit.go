@@ -0,0 +1,197 @@
+package graphqlc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the requests a Client sends.
+type RateLimit struct {
+	// Rate is the sustained number of requests per second. Zero means no
+	// rate limit.
+	Rate float64
+	// Burst is the number of requests that may be sent at once before
+	// Rate applies. Defaults to Rate rounded up, and at least 1.
+	Burst int
+	// MaxInFlight caps the number of concurrent requests. Zero means no
+	// cap.
+	MaxInFlight int
+	// PerOperation gives every operation name its own bucket and in-flight
+	// cap, rather than all operations sharing one.
+	PerOperation bool
+}
+
+// WithRateLimit limits the requests sent by the Client. Operations that
+// have their own limit, see WithOperationRateLimit, are not counted against
+// it. Waiting for the limit respects the request context.
+func WithRateLimit(l RateLimit) ClientOption {
+	return func(c *Client) {
+		c.limits().def = l
+		c.limits().shared = newLimiter(l)
+	}
+}
+
+// WithOperationRateLimit gives the operation with the given name its own
+// limit, separate from the one set with WithRateLimit. This keeps background
+// operations from starving interactive ones on the same Client.
+func WithOperationRateLimit(name string, l RateLimit) ClientOption {
+	return func(c *Client) {
+		c.limits().named[name] = newLimiter(l)
+	}
+}
+
+func (c *Client) limits() *rateLimits {
+	if c.rateLimits == nil {
+		c.rateLimits = &rateLimits{
+			named:   make(map[string]*limiter),
+			dynamic: make(map[string]*limiter),
+		}
+	}
+	return c.rateLimits
+}
+
+// rateLimits holds the limiters of a Client.
+type rateLimits struct {
+	def    RateLimit
+	shared *limiter
+	named  map[string]*limiter
+
+	mu      sync.Mutex
+	dynamic map[string]*limiter // per operation limiters for def.PerOperation
+}
+
+// limiter returns the limiter for the named operation, or nil if it is
+// not limited.
+func (rl *rateLimits) limiter(name string) *limiter {
+	if l, ok := rl.named[name]; ok {
+		return l
+	}
+	if !rl.def.PerOperation {
+		return rl.shared
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	l, ok := rl.dynamic[name]
+	if !ok {
+		l = newLimiter(rl.def)
+		rl.dynamic[name] = l
+	}
+	return l
+}
+
+// acquire waits until a request for op may be sent. The returned function
+// must be called once the request has finished.
+func (c *Client) acquire(ctx context.Context, op *OperationInfo) (func(), error) {
+	if c.rateLimits == nil {
+		return func() {}, nil
+	}
+	l := c.rateLimits.limiter(op.Name)
+	if l == nil {
+		return func() {}, nil
+	}
+	return l.acquire(ctx)
+}
+
+// limiter is a token bucket combined with a semaphore.
+type limiter struct {
+	rate  float64
+	burst float64
+	sem   chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(l RateLimit) *limiter {
+	if l.Rate <= 0 && l.MaxInFlight <= 0 {
+		return nil
+	}
+	ret := &limiter{rate: l.Rate}
+	if l.Rate > 0 {
+		burst := l.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(l.Rate))
+		}
+		ret.burst = float64(burst)
+		ret.tokens = ret.burst
+		ret.last = time.Now()
+	}
+	if l.MaxInFlight > 0 {
+		ret.sem = make(chan struct{}, l.MaxInFlight)
+	}
+	return ret
+}
+
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.sem != nil {
+			<-l.sem
+		}
+	}
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait takes a token from the bucket, waiting for one if necessary.
+func (l *limiter) wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		l.refund()
+		return &rateLimitError{delay: delay}
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.refund()
+		return ctx.Err()
+	}
+}
+
+// rateLimitError is returned when waiting for the rate limit would outlast
+// the context deadline.
+type rateLimitError struct {
+	delay time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("graphql: rate limit wait of %v exceeds context deadline", e.delay)
+}
+
+// refund returns a token that was taken but not used.
+func (l *limiter) refund() {
+	l.mu.Lock()
+	l.tokens = math.Min(l.burst, l.tokens+1)
+	l.mu.Unlock()
+}
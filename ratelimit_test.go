@@ -0,0 +1,103 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRateLimit(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithRateLimit(RateLimit{Rate: 20, Burst: 2}))
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	}
+	// two requests go out in the burst, the other two wait 50ms each
+	is.True(time.Since(start) >= 90*time.Millisecond)
+
+	// a wait that cannot finish before the deadline fails straight away
+	client = NewClient(srv.URL, WithRateLimit(RateLimit{Rate: 1}))
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query {}"), nil))
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err := client.RunCtxRet(ctx, NewRequest("query {}"), nil)
+	is.True(err != nil)
+}
+
+func TestMaxInFlight(t *testing.T) {
+	is := is.New(t)
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithRateLimit(RateLimit{MaxInFlight: 2}))
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			is.NoErr(client.RunCtxRet(context.Background(), NewRequest("query {}"), nil))
+		}()
+	}
+	wg.Wait()
+	is.Equal(atomic.LoadInt32(&maxInFlight), int32(2))
+}
+
+func TestOperationRateLimit(t *testing.T) {
+	is := is.New(t)
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			<-block
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	client := NewClient(srv.URL,
+		WithRateLimit(RateLimit{MaxInFlight: 1}),
+		WithOperationRateLimit("Interactive", RateLimit{MaxInFlight: 1}))
+
+	// a stuck background request holds the shared slot...
+	go func() {
+		req := NewRequest("query Background { x }")
+		req.Header.Set("X-Block", "1")
+		client.RunCtxRet(context.Background(), req, nil)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.RunCtxRet(ctx, NewRequest("query Background { x }"), nil)
+	is.Equal(err, context.DeadlineExceeded)
+
+	// ...but interactive requests have their own
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	is.NoErr(client.RunCtxRet(ctx, NewRequest("query Interactive { x }"), nil))
+}
@@ -0,0 +1,114 @@
+package graphqlc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Response is the HTTP response to an operation, see RunCtxResponse.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+
+	// Data, Errors and Extensions are the raw members of the response body.
+	// They are nil if absent.
+	Data       json.RawMessage
+	Errors     json.RawMessage
+	Extensions json.RawMessage
+
+	// Timings are those of the last attempt, when a request was retried or
+	// sent to another endpoint.
+	Timings Timings
+}
+
+// Timings breaks down the duration of an HTTP round trip. DNS, Connect and
+// TLS are zero when a kept-alive connection was reused.
+type Timings struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// FirstByte is the time from the start of the request to the first byte
+	// of the response.
+	FirstByte time.Duration
+	// Total includes reading the response body.
+	Total time.Duration
+	// Reused is set if the request went over a kept-alive connection.
+	Reused bool
+}
+
+// RunCtxResponse runs the operation like RunCtxRet, and also returns the HTTP
+// response. The response is returned along with the error when the server
+// answered with GraphQL errors or a body that couldn't be decoded, and is nil
+// if no response was received.
+func (c *Client) RunCtxResponse(ctx context.Context, req *Request, resp interface{}) (*Response, error) {
+	res := &Response{}
+	err := c.run(context.WithValue(ctx, responseKey{}, res), req, resp)
+	if res.Header == nil {
+		return nil, err
+	}
+	return res, err
+}
+
+type responseKey struct{}
+
+// responseFrom returns the Response to fill in for the operation of ctx, or
+// nil.
+func responseFrom(ctx context.Context) *Response {
+	res, _ := ctx.Value(responseKey{}).(*Response)
+	return res
+}
+
+// traceTimings returns ctx with a trace timing the round trip starting now,
+// and a function returning the timings so far.
+func traceTimings(ctx context.Context) (context.Context, func() Timings) {
+	start := time.Now()
+	var (
+		// the dialer may connect to several addresses at once
+		mu                               sync.Mutex
+		t                                Timings
+		dnsStart, connectStart, tlsStart time.Time
+	)
+	record := func(f func()) {
+		mu.Lock()
+		f()
+		mu.Unlock()
+	}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { t.Reused = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func() { dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func() { t.DNS = time.Since(dnsStart) })
+		},
+		ConnectStart: func(network, addr string) {
+			record(func() { connectStart = time.Now() })
+		},
+		ConnectDone: func(network, addr string, err error) {
+			record(func() { t.Connect = time.Since(connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			record(func() { tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { t.TLS = time.Since(tlsStart) })
+		},
+		GotFirstResponseByte: func() {
+			record(func() { t.FirstByte = time.Since(start) })
+		},
+	})
+	return ctx, func() Timings {
+		mu.Lock()
+		defer mu.Unlock()
+		timings := t
+		timings.Total = time.Since(start)
+		return timings
+	}
+}
@@ -0,0 +1,67 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRunCtxResponse(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Header().Set("X-RateLimit-Remaining", "99")
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, `{"data":{"user":{"name":"Mat"}},"extensions":{"cost":{"requested":3}}}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	var data struct {
+		User struct{ Name string }
+	}
+	res, err := client.RunCtxResponse(context.Background(), NewRequest(`{ user { name } }`), &data)
+	is.NoErr(err)
+	is.Equal(data.User.Name, "Mat")
+	is.Equal(res.StatusCode, http.StatusOK)
+	is.Equal(res.Header.Get("X-Request-Id"), "req-1")
+	is.Equal(res.Header.Get("X-RateLimit-Remaining"), "99")
+	is.Equal(string(res.Data), `{"user":{"name":"Mat"}}`)
+	is.Equal(res.Errors, nil)
+	is.Equal(string(res.Extensions), `{"cost":{"requested":3}}`)
+	is.True(!res.Timings.Reused)
+	is.True(res.Timings.Connect > 0)
+	is.True(res.Timings.FirstByte >= 10*time.Millisecond)
+	is.True(res.Timings.Total >= res.Timings.FirstByte)
+
+	res, err = client.RunCtxResponse(context.Background(), NewRequest(`{ user { name } }`), nil)
+	is.NoErr(err)
+	is.True(res.Timings.Reused)
+	is.Equal(res.Timings.Connect, time.Duration(0))
+}
+
+func TestRunCtxResponseErrors(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"errors":[{"message":"slow down"}]}`)
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL)
+
+	res, err := client.RunCtxResponse(context.Background(), NewRequest(`{ user { name } }`), nil)
+	is.Equal(err.Error(), "graphql: slow down")
+	is.Equal(res.StatusCode, http.StatusTooManyRequests)
+	is.Equal(string(res.Errors), `[{"message":"slow down"}]`)
+	is.Equal(res.Data, nil)
+
+	srv.Close()
+	res, err = client.RunCtxResponse(context.Background(), NewRequest(`{ user { name } }`), nil)
+	is.True(err != nil)
+	is.Equal(res, nil)
+}
@@ -0,0 +1,141 @@
+package graphqlc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Signer signs outgoing requests, for gateways that authenticate callers by
+// request signature.
+type Signer interface {
+	// Sign is called with each request and its final encoded body, after
+	// every header has been set and just before it is sent. It usually adds
+	// headers to r. Retries are signed again. Subscription handshakes are
+	// signed with a nil body.
+	Sign(r *http.Request, body []byte) error
+}
+
+// SignerFunc is an adapter to use a function as a Signer.
+type SignerFunc func(r *http.Request, body []byte) error
+
+// Sign calls f(r, body).
+func (f SignerFunc) Sign(r *http.Request, body []byte) error {
+	return f(r, body)
+}
+
+// WithSigner signs every request with s.
+func WithSigner(s Signer) ClientOption {
+	return func(c *Client) {
+		c.signer = s
+	}
+}
+
+// Default header names used by HMACSigner.
+const (
+	DefaultSignatureHeader = "X-Signature"
+	DefaultTimestampHeader = "X-Signature-Timestamp"
+	DefaultKeyIDHeader     = "X-Signature-Key-Id"
+	DefaultDigestHeader    = "Digest"
+)
+
+// HMACSigner signs requests with HMAC-SHA256. It sets the digest header to
+// "SHA-256=" followed by the base64 encoded SHA-256 of the body, the
+// timestamp header to the current Unix time in seconds, and the signature
+// header to the hex encoded HMAC of
+//
+//  method + "\n" + path + "\n" + timestamp + "\n" + digest
+//
+// where path includes the query string, if any.
+type HMACSigner struct {
+	Secret []byte
+	// KeyID, if set, is sent in KeyIDHeader so the gateway can tell which
+	// secret was used.
+	KeyID string
+
+	// Header names, defaulting to the Default*Header constants.
+	SignatureHeader string
+	TimestampHeader string
+	KeyIDHeader     string
+	DigestHeader    string
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Sign implements Signer.
+func (s *HMACSigner) Sign(r *http.Request, body []byte) error {
+	if len(s.Secret) == 0 {
+		return errors.New("graphql: HMACSigner has no secret")
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+	digest := bodyDigest(body)
+	r.Header.Set(headerOr(s.DigestHeader, DefaultDigestHeader), digest)
+	r.Header.Set(headerOr(s.TimestampHeader, DefaultTimestampHeader), timestamp)
+	if s.KeyID != "" {
+		r.Header.Set(headerOr(s.KeyIDHeader, DefaultKeyIDHeader), s.KeyID)
+	}
+	r.Header.Set(headerOr(s.SignatureHeader, DefaultSignatureHeader), s.signature(r.Method, r.URL.RequestURI(), timestamp, digest))
+	return nil
+}
+
+// Verify checks the signature of a request received by a server, as set by
+// Sign. Requests whose timestamp is more than maxSkew away from the current
+// time are rejected; zero disables the check.
+func (s *HMACSigner) Verify(r *http.Request, body []byte, maxSkew time.Duration) error {
+	timestamp := r.Header.Get(headerOr(s.TimestampHeader, DefaultTimestampHeader))
+	digest := r.Header.Get(headerOr(s.DigestHeader, DefaultDigestHeader))
+	if digest != bodyDigest(body) {
+		return errors.New("graphql: body digest mismatch")
+	}
+	if maxSkew > 0 {
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return errors.New("graphql: invalid signature timestamp")
+		}
+		now := time.Now
+		if s.Now != nil {
+			now = s.Now
+		}
+		if skew := now().Sub(time.Unix(unix, 0)); skew > maxSkew || skew < -maxSkew {
+			return errors.New("graphql: signature timestamp out of range")
+		}
+	}
+	got, err := hex.DecodeString(r.Header.Get(headerOr(s.SignatureHeader, DefaultSignatureHeader)))
+	if err != nil {
+		return errors.New("graphql: invalid signature")
+	}
+	want, _ := hex.DecodeString(s.signature(r.Method, r.URL.RequestURI(), timestamp, digest))
+	if !hmac.Equal(got, want) {
+		return errors.New("graphql: invalid signature")
+	}
+	return nil
+}
+
+func (s *HMACSigner) signature(method, path, timestamp, digest string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n" + digest))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerOr(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return name
+}
@@ -0,0 +1,83 @@
+package graphqlc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestHMACSigner(t *testing.T) {
+	is := is.New(t)
+	now := time.Unix(1600000000, 0)
+	signer := &HMACSigner{Secret: []byte("s3cret"), KeyID: "k1", Now: func() time.Time { return now }}
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		// the signature covers the body as sent, compressed or not
+		is.NoErr(signer.Verify(r, body, time.Minute))
+		is.Equal(r.Header.Get("X-Signature-Key-Id"), "k1")
+		is.Equal(r.Header.Get("X-Signature-Timestamp"), "1600000000")
+		is.True(strings.HasPrefix(r.Header.Get("Digest"), "SHA-256="))
+
+		tampered := append([]byte(nil), body...)
+		tampered[0] ^= 1
+		is.Equal(signer.Verify(r, tampered, 0).Error(), "graphql: body digest mismatch")
+		other := &HMACSigner{Secret: []byte("other"), Now: signer.Now}
+		is.Equal(other.Verify(r, body, 0).Error(), "graphql: invalid signature")
+		late := &HMACSigner{Secret: signer.Secret, Now: func() time.Time { return now.Add(time.Hour) }}
+		is.Equal(late.Verify(r, body, time.Minute).Error(), "graphql: signature timestamp out of range")
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL+"/v1/graphql?tenant=a", WithSigner(signer), WithCompression(Compression{MinSize: 10}))
+	is.NoErr(client.RunCtxRet(context.Background(), NewRequest(`mutation { insert_items(objects: []) { affected_rows } }`), nil))
+	is.Equal(calls, 1)
+}
+
+func TestSignerError(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unsigned request was sent")
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithSigner(SignerFunc(func(r *http.Request, body []byte) error {
+		return io.ErrUnexpectedEOF
+	})))
+	err := client.RunCtxRet(context.Background(), NewRequest(`query { x }`), nil)
+	is.Equal(err.Error(), "signing request: unexpected EOF")
+}
+
+func TestSignerAfterRateLimit(t *testing.T) {
+	is := is.New(t)
+	var lag []time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signed, err := time.Parse(time.RFC3339Nano, r.Header.Get("X-Signed-At"))
+		is.NoErr(err)
+		lag = append(lag, time.Since(signed))
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithRateLimit(RateLimit{Rate: 5, Burst: 1}), WithSigner(SignerFunc(func(r *http.Request, body []byte) error {
+		r.Header.Set("X-Signed-At", time.Now().Format(time.RFC3339Nano))
+		return nil
+	})))
+	start := time.Now()
+	is.NoErr(client.RunCtxRet(context.Background(), NewRequest(`query { x }`), nil))
+	is.NoErr(client.RunCtxRet(context.Background(), NewRequest(`query { x }`), nil))
+	is.True(time.Since(start) >= 150*time.Millisecond) // the second request waited
+	for _, d := range lag {
+		is.True(d < 100*time.Millisecond) // signed after the wait
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
@@ -16,130 +19,302 @@ type SubscriptionEvent struct {
 	Err  error
 }
 
+// Subscribe runs a subscription and sends its events to notifications until
+// ctx is cancelled, the server completes the subscription or the connection
+// is lost for good. notifications is closed when Subscribe returns.
+// If MaxReconnects is set, a lost connection is re-dialed and the
+// subscription started again.
 func (c *Client) Subscribe(ctx context.Context, req *Request, notifications chan SubscriptionEvent) {
 	defer close(notifications)
-	if id, ws, err := c.startSubscription(req); err == nil {
-		c.handleSubscription(ctx, id, ws, notifications)
-	} else {
-		notifications <- SubscriptionEvent{Err: err}
+	op := newOperationInfo(req)
+	ctx = c.startOperation(ctx, op)
+	var err error
+	defer func() { c.endOperation(ctx, op, err) }()
+	if err = c.checkLimits(req); err != nil {
+		c.notify(ctx, op, notifications, SubscriptionEvent{Err: err})
+		return
+	}
+	if c.Metrics != nil {
+		c.Metrics.SubscriptionStarted()
+		defer c.Metrics.SubscriptionEnded()
+	}
+	authRetried := false
+	for attempt := 0; ; {
+		var id uuid.UUID
+		var ws *websocket.Conn
+		if id, ws, err = c.startSubscription(ctx, op, req); err == nil {
+			err = c.handleSubscription(ctx, op, id, ws, c.tokenRefreshAt(), notifications)
+		}
+		if err == errTokenRefresh {
+			c.log(LevelInfo, "token is about to expire, reconnecting subscription")
+			continue
+		}
+		if errors.Cause(err) == errTokenRejected && !authRetried {
+			c.log(LevelInfo, "authentication failed, refreshing token", Field{"error", err})
+			authRetried = true
+			c.tokens.invalidate()
+			continue
+		}
+		if err == nil || ctx.Err() != nil || attempt >= c.MaxReconnects {
+			break
+		}
+		attempt++
+		c.log(LevelInfo, "subscription connection lost, reconnecting", Field{"error", err})
+		if !c.waitReconnect(ctx) {
+			err = ctx.Err()
+			break
+		}
+		if c.Metrics != nil {
+			c.Metrics.WebsocketReconnect()
+		}
+	}
+	if err != nil {
+		c.notify(ctx, op, notifications, SubscriptionEvent{Err: err})
+	}
+}
+
+var (
+	// errTokenRefresh stops a subscription so it can reconnect with a
+	// fresh token.
+	errTokenRefresh = errors.New("graphql: token is about to expire")
+	// errTokenRejected is returned when the server refuses the token sent
+	// in connection_init.
+	errTokenRejected = errors.New("graphql: token rejected")
+)
+
+// tokenRefreshAt returns when subscriptions should reconnect to refresh
+// their token, or the zero time if never.
+func (c *Client) tokenRefreshAt() time.Time {
+	if !c.hasTokenSource() {
+		return time.Time{}
+	}
+	if t := c.tokens.refreshAt(); t.After(time.Now()) {
+		return t
 	}
+	return time.Time{}
 }
 
-func (c *Client) startSubscription(req *Request) (uuid.UUID, *websocket.Conn, error) {
-	var id uuid.UUID
-	s := strings.SplitN(c.Endpoint, ":", 2)
+// waitReconnect waits before re-dialing a subscription. It returns false if
+// ctx was cancelled in the meantime.
+func (c *Client) waitReconnect(ctx context.Context) bool {
+	wait := c.ReconnectWait
+	if wait == 0 {
+		wait = time.Second
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// notify delivers an event to the subscriber, unless ctx is cancelled first.
+func (c *Client) notify(ctx context.Context, op *OperationInfo, notifications chan SubscriptionEvent, event SubscriptionEvent) {
+	c.subscriptionEvent(ctx, op, event)
+	select {
+	case notifications <- event:
+	case <-ctx.Done():
+	}
+}
+
+func (c *Client) startSubscription(ctx context.Context, op *OperationInfo, req *Request) (id uuid.UUID, ws *websocket.Conn, err error) {
+	t := c.pickEndpoint()
+	defer func() {
+		if err != nil && ws != nil {
+			ws.Close()
+		}
+		c.websocketConnect(ctx, op, t.url, err)
+	}()
+	s := strings.SplitN(t.url, ":", 2)
 	if s[0] == "http" {
 		s[0] = "ws"
 	} else {
 		s[0] = "wss"
 	}
-	wsc, err := websocket.NewConfig(s[0]+":"+s[1], c.Endpoint)
+	wsc, err := websocket.NewConfig(s[0]+":"+s[1], t.url)
 	if err != nil {
 		return id, nil, errors.Wrap(err, "error during websocket config generation")
 	}
-	for key, values := range c.Header {
-		wsc.Header.Set(key, values[0])
-		for _, value := range values[1:] {
-			wsc.Header.Add(key, value)
-		}
+	setHeaders(wsc.Header, c.Header)
+	if err := c.authorize(ctx, wsc.Header); err != nil {
+		return id, nil, err
 	}
-	for key, values := range req.Header {
-		wsc.Header.Set(key, values[0])
-		for _, value := range values[1:] {
-			wsc.Header.Add(key, value)
+	init := gowMsg{Type: "connection_init"}
+	if auth := wsc.Header.Get("Authorization"); auth != "" && c.hasTokenSource() {
+		init.Payload = map[string]interface{}{
+			"headers": map[string]interface{}{"Authorization": auth},
 		}
 	}
+	setHeaders(wsc.Header, HeaderFromContext(ctx))
+	setHeaders(wsc.Header, req.Header)
+	injectTraceContext(ctx, wsc.Header)
 	wsc.Protocol = []string{"graphql-ws"}
-	ws, err := websocket.DialConfig(wsc)
+	var generation uint64
+	if t.breaker != nil {
+		if generation, err = t.breaker.allow(); err != nil {
+			return id, nil, err
+		}
+	}
+	if c.signer != nil {
+		// sign the handshake, which has no body
+		r, err := http.NewRequest(http.MethodGet, t.url, nil)
+		if err == nil {
+			r.Header = wsc.Header
+			err = c.signer.Sign(r.WithContext(ctx), nil)
+		}
+		if err != nil {
+			if t.breaker != nil {
+				t.breaker.cancel(generation)
+			}
+			return id, nil, errors.Wrap(err, "signing request")
+		}
+	}
+	dialStart := time.Now()
+	if c.DialWebsocket != nil {
+		ws, err = c.DialWebsocket(ctx, wsc)
+	} else {
+		ws, err = websocket.DialConfig(wsc)
+	}
+	if t.breaker != nil {
+		t.breaker.record(generation, err != nil)
+	}
+	c.reportTarget(t, time.Since(dialStart), err != nil)
 	if err != nil {
 		return id, nil, errors.Wrap(err, "error during websocket dial")
 	}
-	c.logf(">> %s", jsonStr(gqlConnectionInit))
-	websocket.JSON.Send(ws, gqlConnectionInit)
+	c.logMessage(">>", init)
+	websocket.JSON.Send(ws, init)
 	var recv gowMsg
 	err = websocket.JSON.Receive(ws, &recv)
 	if err != nil {
-		return id, nil, errors.Wrap(err, "could not decode server response after init")
+		return id, ws, errors.Wrap(err, "could not decode server response after init")
 	}
 	for recv.Type != "connection_ack" {
 		switch recv.Type {
 		case "ka":
-			c.logf("<< %s", jsonStr(recv))
+			c.logMessage("<<", recv)
 		case "connection_error":
-			return id, nil, errors.Wrap(jsonError(recv), "server responded with error after init;")
+			if c.hasTokenSource() && isInvalidJWTMessage(recv.Payload) {
+				return id, ws, errors.Wrap(errTokenRejected, jsonStr(recv))
+			}
+			return id, ws, errors.Wrap(jsonError(recv), "server responded with error after init;")
 		default:
-			return id, nil, errors.Wrap(jsonError(recv), "expected an ack but server gave something else")
+			return id, ws, errors.Wrap(jsonError(recv), "expected an ack but server gave something else")
 		}
 		err := websocket.JSON.Receive(ws, &recv)
 		if err != nil {
-			return id, nil, errors.Wrap(err, "could not decode server response after init")
+			return id, ws, errors.Wrap(err, "could not decode server response after init")
 		}
 	}
-	c.logf("<< %s", jsonStr(recv))
+	c.logMessage("<<", recv)
 	id, err = uuid.NewV4()
 	if err != nil {
-		return id, nil, errors.Wrap(err, "failed to generate uuid during subscription")
+		return id, ws, errors.Wrap(err, "failed to generate uuid during subscription")
 	}
 	start := gowMsg{
-		Payload: struct {
-			Query     string      `json:"query"`
-			Variables interface{} `json:"variables"`
-		}{
-			req.q,
-			req.vars,
+		Payload: startPayload{
+			Query:     req.q,
+			Variables: req.vars,
 		},
 		Id:   id.String(),
 		Type: "start",
 	}
-	c.logf(">> %s", jsonStr(start))
+	c.logMessage(">>", start)
 	websocket.JSON.Send(ws, start)
 	return id, ws, nil
 }
 
-func (c *Client) handleSubscription(ctx context.Context, id uuid.UUID, ws *websocket.Conn, notifications chan SubscriptionEvent) {
-	select {
-	case <-ctx.Done():
-		notifications <- SubscriptionEvent{Err: ctx.Err()}
-		return
-	default:
+// handleSubscription reads messages for the subscription id until it
+// completes, ctx is cancelled or the connection fails. If refreshAt is set,
+// it returns errTokenRefresh at that time. The subscription is stopped and
+// the websocket closed before it returns.
+func (c *Client) handleSubscription(ctx context.Context, op *OperationInfo, id uuid.UUID, ws *websocket.Conn, refreshAt time.Time, notifications chan SubscriptionEvent) error {
+	var once sync.Once
+	stop := func() {
+		websocket.JSON.Send(ws, gowMsg{Payload: nil, Id: id.String(), Type: "stop"})
+		ws.Close()
 	}
-	defer websocket.JSON.Send(ws, gowMsg{Payload: nil, Id: id.String(), Type: "stop"})
+	defer once.Do(stop)
+	done := make(chan struct{})
+	defer close(done)
+	var refresh <-chan time.Time
+	if !refreshAt.IsZero() {
+		t := time.NewTimer(time.Until(refreshAt))
+		defer t.Stop()
+		refresh = t.C
+	}
+	refreshing := make(chan struct{})
+	go func() {
+		// unblock the pending Receive when the subscription has to end
+		select {
+		case <-ctx.Done():
+			once.Do(stop)
+		case <-refresh:
+			close(refreshing)
+			once.Do(stop)
+		case <-done:
+		}
+	}()
 	for {
 		var recv gowMsg
 		err := websocket.JSON.Receive(ws, &recv)
-		if err == nil {
-			c.logf("<< %s", jsonStr(recv))
-			switch recv.Type {
-			case "ka":
-			case "error":
-				notifications <- SubscriptionEvent{Err: jsonError(recv.Payload)}
-			case "connection_error":
-				notifications <- SubscriptionEvent{Err: jsonError(recv.Payload)}
-			case "data":
-				if pmap, ok := recv.Payload.(map[string]interface{}); ok {
-					if pmap["data"] != nil && pmap["data"] != "" {
-						c.logf(jsonStr(pmap["data"]))
-						if b, err := json.Marshal(pmap["data"]); err == nil {
-							notifications <- SubscriptionEvent{Data: b}
-						} else {
-							notifications <- SubscriptionEvent{Err: errors.Wrap(err, "could not decode data section of server response:")}
-						}
-					} else if err, exists := pmap["errors"]; exists {
-						c.logf("got resolver errrors during subscription: %s", jsonStr(err))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			select {
+			case <-refreshing:
+				return errTokenRefresh
+			default:
+			}
+			if isJSONError(err) {
+				c.notify(ctx, op, notifications, SubscriptionEvent{Err: errors.Wrap(err, "could not parse response into a json object")})
+				continue
+			}
+			return errors.Wrap(err, "could not read from websocket")
+		}
+		c.logMessage("<<", recv)
+		switch recv.Type {
+		case "ka":
+		case "complete":
+			return nil
+		case "error":
+			c.notify(ctx, op, notifications, SubscriptionEvent{Err: jsonError(recv.Payload)})
+		case "connection_error":
+			c.notify(ctx, op, notifications, SubscriptionEvent{Err: jsonError(recv.Payload)})
+		case "data":
+			if pmap, ok := recv.Payload.(map[string]interface{}); ok {
+				if pmap["data"] != nil && pmap["data"] != "" {
+					if b, err := json.Marshal(pmap["data"]); err == nil {
+						c.notify(ctx, op, notifications, SubscriptionEvent{Data: b})
 					} else {
-						c.logf("got a data response from the server during subscription, but no data.")
+						c.notify(ctx, op, notifications, SubscriptionEvent{Err: errors.Wrap(err, "could not decode data section of server response:")})
 					}
+				} else if err, exists := pmap["errors"]; exists {
+					c.log(LevelWarn, "got resolver errors during subscription", Field{"errors", jsonStr(err)})
 				} else {
-					c.logf("received data message during subscription but could not parse it into a json object.")
+					c.log(LevelWarn, "got a data response from the server during subscription, but no data")
 				}
-			default:
-				notifications <- SubscriptionEvent{Err: errors.Wrap(jsonError(recv), "could not identify response message.")}
+			} else {
+				c.log(LevelWarn, "received data message during subscription but could not parse it into a json object")
 			}
-		} else {
-			notifications <- SubscriptionEvent{Err: errors.Wrap(err, "could not parse response into a json object")}
+		default:
+			c.notify(ctx, op, notifications, SubscriptionEvent{Err: errors.Wrap(jsonError(recv), "could not identify response message.")})
 		}
 	}
 }
+
+func isJSONError(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return false
+}
+
 func jsonError(payload interface{}) error {
 	return errors.New(jsonStr(payload))
 }
@@ -150,6 +325,19 @@ func jsonStr(payload interface{}) string {
 	return fmt.Sprintf("%s", payload)
 }
 
+// logMessage logs a graphql-ws message sent (">>") or received ("<<").
+func (c *Client) logMessage(direction string, m gowMsg) {
+	if c.logEnabled() {
+		c.debug(direction + " " + c.redactMessage(m))
+	}
+}
+
+// startPayload is the payload of a graphql-ws start message.
+type startPayload struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
 //Graphql over websocket message struct.
 type gowMsg struct {
 	Payload interface{} `json:"payload"`
@@ -157,4 +345,3 @@ type gowMsg struct {
 	Type    string      `json:"type"`
 }
 
-var gqlConnectionInit = gowMsg{Payload: nil, Type: "connection_init"}
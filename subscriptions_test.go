@@ -0,0 +1,130 @@
+package graphqlc
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"golang.org/x/net/websocket"
+)
+
+// subscriptionServer returns a graphql-ws server calling handle after the
+// start message of each connection, numbered from 1.
+func subscriptionServer(handle func(n int32, ws *websocket.Conn, id string)) websocket.Server {
+	var conns int32
+	return websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			config.Protocol = []string{"graphql-ws"}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			n := atomic.AddInt32(&conns, 1)
+			var m gowMsg
+			websocket.JSON.Receive(ws, &m) // connection_init
+			websocket.JSON.Send(ws, gowMsg{Type: "connection_ack"})
+			websocket.JSON.Receive(ws, &m) // start
+			handle(n, ws, m.Id)
+		},
+	}
+}
+
+func sendData(ws *websocket.Conn, id string, n int32) {
+	websocket.JSON.Send(ws, gowMsg{Type: "data", Id: id, Payload: map[string]interface{}{"data": map[string]interface{}{"n": n}}})
+}
+
+func TestSubscribeComplete(t *testing.T) {
+	is := is.New(t)
+	stopped := make(chan string, 1)
+	server := subscriptionServer(func(n int32, ws *websocket.Conn, id string) {
+		sendData(ws, id, n)
+		websocket.JSON.Send(ws, gowMsg{Type: "complete", Id: id})
+		var m gowMsg
+		websocket.JSON.Receive(ws, &m)
+		stopped <- m.Type
+	})
+	client := NewClient("http://localhost/graphql", WithHandler(server))
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(context.Background(), NewRequest("subscription { n }"), events)
+	var got []string
+	for ev := range events {
+		is.NoErr(ev.Err)
+		got = append(got, string(ev.Data))
+	}
+	is.Equal(got, []string{`{"n":1}`}) // complete ends the subscription without an error
+	is.Equal(<-stopped, "stop")
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	is := is.New(t)
+	closed := make(chan struct{})
+	server := subscriptionServer(func(n int32, ws *websocket.Conn, id string) {
+		sendData(ws, id, n)
+		var m gowMsg
+		for websocket.JSON.Receive(ws, &m) == nil {
+		}
+		close(closed)
+	})
+	client := NewClient("http://localhost/graphql", WithHandler(server))
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(ctx, NewRequest("subscription { n }"), events)
+	ev := <-events
+	is.NoErr(ev.Err)
+	cancel()
+	for range events {
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("websocket not closed after the context was cancelled")
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	is := is.New(t)
+	server := subscriptionServer(func(n int32, ws *websocket.Conn, id string) {
+		sendData(ws, id, n)
+		if n < 3 {
+			ws.Close() // connection lost
+			return
+		}
+		websocket.JSON.Send(ws, gowMsg{Type: "complete", Id: id})
+	})
+	metrics := NewMemoryMetrics()
+	client := NewClient("http://localhost/graphql", WithHandler(server))
+	client.Metrics = metrics
+	client.MaxReconnects = 2
+	client.ReconnectWait = time.Millisecond
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(context.Background(), NewRequest("subscription { n }"), events)
+	var got []string
+	for ev := range events {
+		is.NoErr(ev.Err)
+		got = append(got, string(ev.Data))
+	}
+	is.Equal(got, []string{`{"n":1}`, `{"n":2}`, `{"n":3}`})
+	is.Equal(metrics.Snapshot().WebsocketReconnects, int64(2))
+}
+
+func TestSubscribeNoReconnect(t *testing.T) {
+	is := is.New(t)
+	server := subscriptionServer(func(n int32, ws *websocket.Conn, id string) {
+		sendData(ws, id, n)
+		ws.Close()
+	})
+	client := NewClient("http://localhost/graphql", WithHandler(server))
+	events := make(chan SubscriptionEvent)
+	go client.Subscribe(context.Background(), NewRequest("subscription { n }"), events)
+	var got []SubscriptionEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	// without MaxReconnects, a lost connection ends the subscription with
+	// an error
+	is.Equal(len(got), 2)
+	is.Equal(string(got[0].Data), `{"n":1}`)
+	is.True(got[1].Err != nil)
+}
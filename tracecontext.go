@@ -0,0 +1,60 @@
+package graphqlc
+
+import (
+	"context"
+	"net/http"
+)
+
+// TraceContext holds the W3C trace-context headers to propagate with an
+// operation. See https://www.w3.org/TR/trace-context/.
+type TraceContext struct {
+	TraceParent string
+	TraceState  string
+}
+
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a copy of ctx carrying tc. Requests and
+// subscriptions made with the returned context send tc as the traceparent
+// and tracestate headers.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the TraceContext stored in ctx, if any.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// Valid reports whether the traceparent is well formed (version 00).
+func (tc TraceContext) Valid() bool {
+	p := tc.TraceParent
+	if len(p) != 55 || p[2] != '-' || p[35] != '-' || p[52] != '-' {
+		return false
+	}
+	for i, c := range []byte(p) {
+		if i == 2 || i == 35 || i == 52 {
+			continue
+		}
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	// version ff is forbidden, as are all zero trace and parent ids.
+	return p[:2] != "ff" && p[3:35] != "00000000000000000000000000000000" && p[36:52] != "0000000000000000"
+}
+
+// injectTraceContext sets the trace-context headers from ctx on h.
+func injectTraceContext(ctx context.Context, h http.Header) {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok || !tc.Valid() {
+		return
+	}
+	h.Set("traceparent", tc.TraceParent)
+	if tc.TraceState != "" {
+		h.Set("tracestate", tc.TraceState)
+	} else {
+		h.Del("tracestate")
+	}
+}